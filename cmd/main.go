@@ -1,9 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"github.com/SawitProRecruitment/UserService/middleware"
 	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/SawitProRecruitment/UserService/shared/notification"
+	"github.com/SawitProRecruitment/UserService/shared/password"
+	"github.com/SawitProRecruitment/UserService/shared/phone"
+	"github.com/SawitProRecruitment/UserService/shared/revocation"
+	"github.com/SawitProRecruitment/UserService/shared/secretbox"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/handler"
@@ -14,12 +27,67 @@ import (
 
 func main() {
 	e := echo.New()
+	e.IPExtractor = newIPExtractor()
 
-	var server generated.ServerInterface = newServer()
+	repo := newRepository()
+	revoked := newRevocationStore(repo)
+	revocation.StartPruning(context.Background(), revoked, time.Hour, func(err error) { e.Logger.Error(err) })
+
+	jwtSigner, err := jwt.GetSigner()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// kill -HUP picks up rotated keys, see jwt.KeyRing
+	err = jwt.ReloadKeysOnSignal(context.Background(), func(err error) {
+		if err != nil {
+			e.Logger.Errorf("failed to reload jwt keys, keeping the current keys: %v", err)
+			return
+		}
+		e.Logger.Info("reloaded jwt keys")
+	}, syscall.SIGHUP)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	var server generated.ServerInterface = newServer(repo, revoked, jwtSigner)
+
+	spec, err := generated.GetSwagger()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	permissions, err := middleware.PermissionsFromSpec(spec)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	if routes := permissions.Unprotected(spec, "/v1/admin/"); len(routes) > 0 {
+		e.Logger.Fatalf("admin routes without x-permissions in api.yml: %v", routes)
+	}
+
+	// ADMIN_USER_IDS predates roles. It only bootstraps the first admins, once
+	// anyone has the admin role it is ignored, so a role revoked in the
+	// database is not given back on the next start.
+	if ids := getEnvInt64List("ADMIN_USER_IDS"); len(ids) > 0 {
+		assigned, err := repo.BootstrapRole(context.Background(), "admin", ids)
+		switch {
+		case err != nil:
+			e.Logger.Errorf("failed to assign the admin role to ADMIN_USER_IDS: %v", err)
+		case !assigned:
+			e.Logger.Info("ADMIN_USER_IDS is ignored, the admin role is already assigned")
+		}
+	}
 
 	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
-	e.Use(middleware.Auth("POST:/v1/users/login", "POST:/v1/users/profile"))
+	e.Use(middleware.Auth(jwtSigner, revoked,
+		"POST:/v1/users/login", "POST:/v1/users/login/otp/request", "POST:/v1/users/login/otp/verify",
+		"POST:/v1/users/login/mfa", "POST:/v1/users/profile", "POST:/v1/users/token/refresh",
+		"POST:/v1/users/password/reset-request", "POST:/v1/users/password/reset",
+		"POST:/v1/oauth/token", "POST:/v1/oauth/introspect", "GET:/v1/oauth/authorize", "POST:/v1/oauth/authorize",
+		"GET:/.well-known/jwks.json", "GET:/.well-known/openid-configuration",
+	))
+	e.Use(middleware.RestrictDelegated("GET:/v1/oauth/userinfo"))
+	e.Use(middleware.Authorize(permissions))
 	e.HTTPErrorHandler = e.DefaultHTTPErrorHandler
 
 	generated.RegisterHandlers(e, server)
@@ -29,18 +97,219 @@ func main() {
 	e.Logger.Fatal(e.Start(":1323"))
 }
 
-func newServer() *handler.Server {
+func newRepository() *repository.Repository {
 	var dbDsn = os.Getenv("DATABASE_URL")
 
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
-		Dsn: dbDsn,
+	lockoutPolicy := repository.DefaultLockoutPolicy()
+	lockoutPolicy.MaxFailedAttempts = getEnvInt("LOCKOUT_MAX_FAILED_ATTEMPTS", lockoutPolicy.MaxFailedAttempts)
+	lockoutPolicy.FailureWindow = getEnvDuration("LOCKOUT_FAILURE_WINDOW", lockoutPolicy.FailureWindow)
+	lockoutPolicy.LockoutDuration = getEnvDuration("LOCKOUT_DURATION", lockoutPolicy.LockoutDuration)
+	lockoutPolicy.MaxLockoutDuration = getEnvDuration("LOCKOUT_MAX_DURATION", lockoutPolicy.MaxLockoutDuration)
+
+	return repository.NewRepository(repository.NewRepositoryOptions{
+		Dsn:           dbDsn,
+		LockoutPolicy: lockoutPolicy,
 	})
+}
 
-	jwtSigner := jwt.GetSigner()
+// newRevocationStore uses REVOCATION_STORE to choose where revoked tokens are
+// kept, the in-memory store only works when running a single instance.
+func newRevocationStore(repo *repository.Repository) revocation.Store {
+	if os.Getenv("REVOCATION_STORE") == "memory" {
+		return revocation.NewMemoryStore()
+	}
+	return revocation.NewPostgresStore(repo.Db)
+}
+
+func newServer(repo repository.RepositoryInterface, revoked revocation.Store, jwtSigner jwt.Signer) *handler.Server {
+	passwordPolicy := password.DefaultPolicy()
+	passwordPolicy.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", passwordPolicy.MinLength)
+	passwordPolicy.MaxLength = getEnvInt("PASSWORD_MAX_LENGTH", passwordPolicy.MaxLength)
+	passwordPolicy.RequireUpper = getEnvBool("PASSWORD_REQUIRE_UPPER", passwordPolicy.RequireUpper)
+	passwordPolicy.RequireLower = getEnvBool("PASSWORD_REQUIRE_LOWER", passwordPolicy.RequireLower)
+	passwordPolicy.RequireDigit = getEnvBool("PASSWORD_REQUIRE_DIGIT", passwordPolicy.RequireDigit)
+	passwordPolicy.RequireSymbol = getEnvBool("PASSWORD_REQUIRE_SYMBOL", passwordPolicy.RequireSymbol)
+	passwordPolicy.ForbidCommon = getEnvBool("PASSWORD_FORBID_COMMON", passwordPolicy.ForbidCommon)
 
 	opts := handler.NewServerOptions{
 		Repository: repo,
 		JWT:        jwtSigner,
+		Revocation: revoked,
+		SMSSender:  newSMSSender(),
+
+		PasswordPolicy:  passwordPolicy,
+		PasswordHasher:  newPasswordHasher(),
+		PhoneParser:     newPhoneParser(),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 0),
+		MFASecretBox:    newMFASecretBox(),
+		CodeHashKey:     newCodeHashKey(),
 	}
 	return handler.NewServer(opts)
 }
+
+// newPasswordHasher hashes passwords with the Argon2id parameters in
+// PASSWORD_ARGON2_MEMORY_KIB, PASSWORD_ARGON2_ITERATIONS and
+// PASSWORD_ARGON2_PARALLELISM, the defaults are used for those not set.
+func newPasswordHasher() *password.Hasher {
+	params := password.DefaultArgon2idParams()
+	params.Memory = uint32(getEnvUint("PASSWORD_ARGON2_MEMORY_KIB", uint64(params.Memory), 32))
+	params.Iterations = uint32(getEnvUint("PASSWORD_ARGON2_ITERATIONS", uint64(params.Iterations), 32))
+	params.Parallelism = uint8(getEnvUint("PASSWORD_ARGON2_PARALLELISM", uint64(params.Parallelism), 8))
+
+	hasher, err := password.NewHasher(params)
+	if err != nil {
+		panic("failed to create password hasher, err: " + err.Error())
+	}
+	return hasher
+}
+
+// newPhoneParser accepts phone numbers of the countries in
+// PHONE_ALLOWED_COUNTRIES, a comma separated list of ISO 3166-1 alpha-2 codes.
+// Numbers without a country calling code belong to PHONE_DEFAULT_COUNTRY.
+func newPhoneParser() *phone.Parser {
+	defaultCountry := os.Getenv("PHONE_DEFAULT_COUNTRY")
+	if defaultCountry == "" {
+		defaultCountry = "ID"
+	}
+
+	var allowedCountries []string
+	for _, country := range strings.Split(os.Getenv("PHONE_ALLOWED_COUNTRIES"), ",") {
+		if country = strings.TrimSpace(country); country != "" {
+			allowedCountries = append(allowedCountries, country)
+		}
+	}
+
+	parser, err := phone.NewParser(defaultCountry, allowedCountries...)
+	if err != nil {
+		panic("failed to create phone number parser, err: " + err.Error())
+	}
+	return parser
+}
+
+// newIPExtractor decides which client IP is stored with sessions and audit
+// logs. Behind a proxy TRUSTED_PROXIES lists its address ranges in CIDR
+// notation, the client IP is then read from X-Forwarded-For as far as those
+// proxies appended to it. Without it the IP of the connection is used, so a
+// client can not choose its own IP with the header.
+func newIPExtractor() echo.IPExtractor {
+	var options []echo.TrustOption
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("failed to parse TRUSTED_PROXIES, err: " + err.Error())
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	if len(options) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// only the listed proxies are trusted, not every private address
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// newMFASecretBox encrypts TOTP secrets with MFA_ENCRYPTION_KEY, a base64
+// encoded 32 byte key. Two-factor authentication is not available without it.
+func newMFASecretBox() *secretbox.Box {
+	encoded := os.Getenv("MFA_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		panic("failed to decode mfa encryption key, err: " + err.Error())
+	}
+
+	box, err := secretbox.New(key)
+	if err != nil {
+		panic("failed to create mfa secret box, err: " + err.Error())
+	}
+	return box
+}
+
+// newCodeHashKey reads CODE_HASH_KEY, a base64 encoded key of at least 32
+// bytes that the short codes sent by SMS and the recovery codes are hashed
+// with. It must be the same on every instance and kept out of the database,
+// changing it invalidates the pending codes and every recovery code.
+func newCodeHashKey() []byte {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("CODE_HASH_KEY"))
+	if err != nil {
+		panic("failed to decode code hash key, err: " + err.Error())
+	}
+	if len(key) < 32 {
+		panic("CODE_HASH_KEY must be set to a base64 encoded key of at least 32 bytes")
+	}
+	return key
+}
+
+// newSMSSender writes messages to SMS_LOG_FILE, or to stdout when it is not
+// set, until a real SMS provider is integrated.
+func newSMSSender() notification.SMSSender {
+	path := os.Getenv("SMS_LOG_FILE")
+	if path == "" {
+		return notification.NewLogSMSSender(os.Stdout)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		panic("failed to open sms log file, err: " + err.Error())
+	}
+	return notification.NewLogSMSSender(file)
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvUint panics when the variable is set but is not an unsigned integer
+// of bitSize bits, instead of silently wrapping it around.
+func getEnvUint(key string, fallback uint64, bitSize int) uint64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	value, err := strconv.ParseUint(raw, 10, bitSize)
+	if err != nil {
+		panic(fmt.Sprintf("%s must be an unsigned %d-bit integer, err: %v", key, bitSize, err))
+	}
+	return value
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvInt64List(key string) (values []int64) {
+	for _, raw := range strings.Split(os.Getenv(key), ",") {
+		value, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -12,10 +12,369 @@ CREATE TABLE IF NOT EXISTS users
 (
     id           serial PRIMARY KEY,
     name         VARCHAR(50)        NOT NULL,
+    -- E.164 format, e.g. +628123456789, so that the unique constraint holds
+    -- however the number was entered
     phone_number VARCHAR(50) UNIQUE NOT NULL,
+    -- PHC string, e.g. $argon2id$v=19$..., or a legacy hex encoded bcrypt digest
     password     text               NOT NULL,
-    salt         VARCHAR(255)       NOT NULL,
+    -- only used by legacy bcrypt hashes, empty once the password is rehashed
+    salt         VARCHAR(255)       NOT NULL DEFAULT '',
 
-    created_at   timestamptz default current_timestamp,
+    successful_login_count integer NOT NULL DEFAULT 0,
+    failed_login_count     integer NOT NULL DEFAULT 0,
+    last_login_at          timestamptz,
+    last_failed_login_at   timestamptz,
+
+    failed_attempts_in_window integer NOT NULL DEFAULT 0,
+    failed_window_started_at  timestamptz,
+    lockout_count             integer NOT NULL DEFAULT 0,
+    locked_until              timestamptz,
+
+    -- set once the phone number is verified by a code sent to it by SMS
+    phone_verified_at timestamptz,
+    -- set by an admin, a deactivated user can not log in anymore
+    deactivated_at    timestamptz,
+
+    created_at   timestamptz NOT NULL default current_timestamp,
     updated_at   timestamptz default current_timestamp
 );
+
+/** Columns added after the table was first created, CREATE TABLE IF NOT EXISTS skips existing tables. */
+ALTER TABLE users
+    ALTER COLUMN salt SET DEFAULT '',
+    ADD COLUMN IF NOT EXISTS successful_login_count    integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS failed_login_count        integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_login_at             timestamptz,
+    ADD COLUMN IF NOT EXISTS last_failed_login_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS failed_attempts_in_window integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS failed_window_started_at  timestamptz,
+    ADD COLUMN IF NOT EXISTS lockout_count             integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS locked_until              timestamptz,
+    ADD COLUMN IF NOT EXISTS phone_verified_at         timestamptz,
+    ADD COLUMN IF NOT EXISTS deactivated_at            timestamptz;
+
+UPDATE users SET created_at = current_timestamp WHERE created_at IS NULL;
+ALTER TABLE users ALTER COLUMN created_at SET NOT NULL;
+
+/**
+ * Phone numbers stored before they were normalized to E.164, e.g. "0812-3456 789"
+ * or "+620812...", are rewritten the way the service normalizes Indonesian
+ * numbers. A number that would become the number of another user, or that is
+ * still not E.164 afterwards, is left unchanged and reported with a notice to
+ * be resolved by hand; the user can not log in with it until then.
+ */
+DO
+$$
+    DECLARE
+        stored     record;
+        normalized text;
+    BEGIN
+        FOR stored IN SELECT id, phone_number
+                      FROM users
+                      WHERE phone_number !~ '^\+[1-9][0-9]+$' OR phone_number LIKE '+620%'
+                      ORDER BY id
+            LOOP
+                normalized := regexp_replace(stored.phone_number, '[[:space:].()-]', '', 'g');
+                normalized := CASE
+                    WHEN normalized LIKE '+620%' THEN '+62' || substr(normalized, 5)
+                    WHEN normalized LIKE '+%' THEN normalized
+                    WHEN normalized LIKE '620%' THEN '+62' || substr(normalized, 4)
+                    WHEN normalized LIKE '62%' THEN '+' || normalized
+                    WHEN normalized LIKE '0%' THEN '+62' || substr(normalized, 2)
+                    ELSE normalized
+                    END;
+
+                IF normalized !~ '^\+[1-9][0-9]{7,14}$' THEN
+                    RAISE NOTICE 'user %: phone number "%" can not be normalized, left unchanged',
+                        stored.id, stored.phone_number;
+                ELSIF EXISTS (SELECT 1 FROM users WHERE phone_number = normalized) THEN
+                    RAISE NOTICE 'user %: phone number "%" normalizes to % of another user, left unchanged',
+                        stored.id, stored.phone_number, normalized;
+                ELSE
+                    UPDATE users SET phone_number = normalized WHERE id = stored.id;
+                END IF;
+            END LOOP;
+    END
+$$;
+
+/**
+ * Indexes of the admin user list, which pages by (sorted column, id) so every
+ * page is an index range scan. Name search matches any part of the name, which
+ * needs a trigram index, and phone search the start of the number, which needs
+ * text_pattern_ops unless the database uses the C collation.
+ */
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_name_id_idx ON users (name, id);
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_phone_number_pattern_idx ON users (phone_number text_pattern_ops);
+
+/** A session is created per login and shares its id with the refresh token family. */
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           VARCHAR(36) PRIMARY KEY,
+    user_id      integer      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   text         NOT NULL DEFAULT '',
+    ip_address   VARCHAR(45)  NOT NULL DEFAULT '',
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    -- only set for sessions started by an oauth client, whose tokens grant
+    -- the space separated scope
+    client_id    VARCHAR(100) NOT NULL DEFAULT '',
+    scope        text         NOT NULL DEFAULT '',
+    revoked_at   timestamptz,
+
+    created_at   timestamptz default current_timestamp,
+    last_seen_at timestamptz default current_timestamp
+);
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS client_id VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS scope     text         NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id          bigserial PRIMARY KEY,
+    user_id     integer      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id   VARCHAR(36)  NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    token_hash  VARCHAR(64) UNIQUE NOT NULL,
+    expires_at  timestamptz  NOT NULL,
+    used_at     timestamptz,
+    revoked_at  timestamptz,
+
+    created_at  timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+/** Refresh tokens issued before sessions existed belong to no session, they are dropped to add the key. */
+DO
+$$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'refresh_tokens_family_id_fkey') THEN
+            DELETE FROM refresh_tokens WHERE family_id NOT IN (SELECT id FROM sessions);
+            ALTER TABLE refresh_tokens
+                ADD CONSTRAINT refresh_tokens_family_id_fkey
+                    FOREIGN KEY (family_id) REFERENCES sessions (id) ON DELETE CASCADE;
+        END IF;
+    END
+$$;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti        VARCHAR(36) PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+-- Every token of a user is now revoked through the sessions of the user.
+DROP TABLE IF EXISTS revoked_user_tokens;
+
+CREATE TABLE IF NOT EXISTS password_reset_codes
+(
+    id          bigserial PRIMARY KEY,
+    user_id     integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash   VARCHAR(64) NOT NULL,
+    attempts    integer     NOT NULL DEFAULT 0,
+    expires_at  timestamptz NOT NULL,
+    consumed_at timestamptz,
+
+    created_at  timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_codes_user_id_idx ON password_reset_codes (user_id);
+
+/** A code sent by SMS to a phone number, the number becomes the user's verified phone number once confirmed. */
+CREATE TABLE IF NOT EXISTS phone_verifications
+(
+    id           bigserial PRIMARY KEY,
+    user_id      integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phone_number VARCHAR(50) NOT NULL,
+    code_hash    VARCHAR(64) NOT NULL,
+    attempts     integer     NOT NULL DEFAULT 0,
+    expires_at   timestamptz NOT NULL,
+    consumed_at  timestamptz,
+
+    created_at   timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS phone_verifications_user_id_idx ON phone_verifications (user_id);
+
+/** A one-time code sent by SMS to login without a password, rate limited per phone number. */
+CREATE TABLE IF NOT EXISTS login_otps
+(
+    id           bigserial PRIMARY KEY,
+    user_id      integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phone_number VARCHAR(50) NOT NULL,
+    code_hash    VARCHAR(64) NOT NULL,
+    attempts     integer     NOT NULL DEFAULT 0,
+    expires_at   timestamptz NOT NULL,
+    consumed_at  timestamptz,
+
+    created_at   timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS login_otps_phone_number_created_at_idx ON login_otps (phone_number, created_at);
+
+/** The authenticator app of a user, two-factor authentication is enabled once it is confirmed. */
+CREATE TABLE IF NOT EXISTS user_totp_secrets
+(
+    user_id        integer PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    -- AES-256-GCM encrypted with MFA_ENCRYPTION_KEY
+    secret         text        NOT NULL,
+    -- time step of the last accepted code, codes can not be replayed
+    last_used_step bigint      NOT NULL DEFAULT 0,
+    confirmed_at   timestamptz,
+
+    created_at     timestamptz default current_timestamp
+);
+
+/** Handed out by a login with the correct password, exchanged for tokens with a second factor. */
+CREATE TABLE IF NOT EXISTS mfa_challenges
+(
+    id           bigserial PRIMARY KEY,
+    user_id      integer      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    device_label VARCHAR(100) NOT NULL DEFAULT '',
+    attempts     integer      NOT NULL DEFAULT 0,
+    expires_at   timestamptz  NOT NULL,
+    consumed_at  timestamptz,
+
+    created_at   timestamptz default current_timestamp
+);
+
+/** Single-use codes that replace a code of the authenticator app, e.g. when the phone holding it is lost. */
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    id         bigserial PRIMARY KEY,
+    user_id    integer     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    timestamptz,
+
+    created_at timestamptz default current_timestamp
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_code_hash_idx ON mfa_recovery_codes (user_id, code_hash);
+
+/** Security relevant actions, kept without foreign keys so they outlive the users they are about. */
+CREATE TABLE IF NOT EXISTS audit_logs
+(
+    id         bigserial PRIMARY KEY,
+    -- the user who performed the action
+    actor_id   integer     NOT NULL,
+    -- the user the action was performed on
+    user_id    integer     NOT NULL,
+    action     VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent text        NOT NULL DEFAULT '',
+    -- what changed, e.g. {"full_name": {"old": "...", "new": "..."}}
+    details    jsonb       NOT NULL DEFAULT '{}',
+
+    created_at timestamptz default current_timestamp
+);
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS details jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS audit_logs_user_id_created_at_idx ON audit_logs (user_id, created_at);
+
+/**
+ * A service that authenticates with its client id and secret, e.g. to obtain
+ * access tokens of its own with the client_credentials grant, or an app that
+ * signs users in with OpenID Connect. Secrets are generated, e.g. with
+ * `openssl rand -base64 32`, and only their SHA-256 hex digest is stored. A
+ * public client, e.g. a single page app, has an empty secret_hash and can only
+ * use the authorization code grant with PKCE. Scopes are separated by spaces,
+ * e.g. 'introspect' or 'openid profile phone', and are the most a token of
+ * the client is granted. Redirect URIs are separated by spaces as well and
+ * must match the redirect_uri of an authorization request exactly.
+ */
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    client_id     VARCHAR(100) PRIMARY KEY,
+    secret_hash   VARCHAR(64)  NOT NULL DEFAULT '',
+    scopes        text         NOT NULL DEFAULT '',
+    redirect_uris text         NOT NULL DEFAULT '',
+
+    created_at    timestamptz default current_timestamp
+);
+
+ALTER TABLE oauth_clients
+    ALTER COLUMN secret_hash SET DEFAULT '',
+    ADD COLUMN IF NOT EXISTS redirect_uris text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes
+(
+    id             bigserial PRIMARY KEY,
+    code_hash      VARCHAR(64)  UNIQUE NOT NULL,
+    client_id      VARCHAR(100) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    user_id        integer      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri   text         NOT NULL,
+    scope          text         NOT NULL DEFAULT '',
+    nonce          text         NOT NULL DEFAULT '',
+    -- the base64url encoded SHA-256 digest of the PKCE code verifier
+    code_challenge VARCHAR(43)  NOT NULL,
+    expires_at     timestamptz  NOT NULL,
+    consumed_at    timestamptz,
+
+    created_at     timestamptz default current_timestamp
+);
+
+/** A role groups the permissions granted to the users it is assigned to, e.g. admin. */
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          serial PRIMARY KEY,
+    name        VARCHAR(50) UNIQUE NOT NULL,
+    description text        NOT NULL DEFAULT '',
+
+    created_at  timestamptz default current_timestamp
+);
+
+/**
+ * A permission is named after a resource and an action, e.g. users:unlock, and
+ * is required by the operations of api.yml listing it in x-permissions.
+ */
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          serial PRIMARY KEY,
+    name        VARCHAR(100) UNIQUE NOT NULL,
+    description text         NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       integer NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id integer NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    integer NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+
+    created_at timestamptz default current_timestamp,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_id_idx ON user_roles (role_id);
+
+INSERT INTO roles (name, description)
+VALUES ('admin', 'Manages the accounts of other users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description)
+VALUES ('users:read', 'List and view the accounts of users'),
+       ('users:write', 'Create, update, lock and deactivate the accounts of users'),
+       ('users:unlock', 'Unlock accounts locked by failed logins')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+  AND permissions.name IN ('users:read', 'users:write', 'users:unlock')
+ON CONFLICT DO NOTHING;
@@ -1,11 +1,28 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/SawitProRecruitment/UserService/shared/totp"
 	"github.com/SawitProRecruitment/UserService/shared/util"
 	"github.com/labstack/echo/v4"
+	"html/template"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 func (s *Server) UsersLogin(ctx echo.Context) error {
@@ -20,17 +37,32 @@ func (s *Server) UsersLogin(ctx echo.Context) error {
 		return err
 	}
 
-	if err := util.ValidatePhoneNumber(req.PhoneNumber); err != nil {
+	err = validateDeviceLabel(req.DeviceLabel)
+	if err != nil {
 		return err
 	}
 
-	output, err := s.Repository.FindUserByPhoneNumber(rctx, req.PhoneNumber)
+	user, err := s.verifyPassword(ctx, req.PhoneNumber, req.Password)
+	if err != nil {
+		return err
+	}
+
+	// the failed login count is only reset once every factor is verified, so
+	// the lockout also limits guessing the second factor
+	authenticator, err := s.Repository.FindTOTP(rctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if authenticator.ConfirmedAt != nil {
+		return s.startMFAChallenge(ctx, user.Id, req.DeviceLabel)
+	}
+
+	err = s.Repository.IncrementSuccessfulLogin(rctx, user.Id)
 	if err != nil {
 		return err
 	}
-	res.Id = output.Id
 
-	res.AccessToken, err = s.jwt.CreateAccessToken(output.Id)
+	res, err = s.startSession(ctx, user.Id, req.DeviceLabel)
 	if err != nil {
 		return err
 	}
@@ -38,82 +70,301 @@ func (s *Server) UsersLogin(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, res)
 }
 
-func (s *Server) GetUsersProfile(ctx echo.Context, _ generated.GetUsersProfileParams) error {
+// verifyPassword returns the user with the phone number when the password
+// matches, counting a mismatch as a failed login towards the lockout.
+func (s *Server) verifyPassword(ctx echo.Context, phoneNumber, password string) (repository.User, error) {
+	rctx := ctx.Request().Context()
+
+	phoneNumber, err := s.normalizePhoneNumber(phoneNumber)
+	if err != nil {
+		return repository.User{}, err
+	}
+
+	output, err := s.Repository.FindUserByPhoneNumber(rctx, phoneNumber)
+	if err != nil {
+		return repository.User{}, err
+	}
+
+	if output.LockedUntil != nil && output.LockedUntil.After(time.Now()) {
+		return repository.User{}, accountLockedError(ctx, *output.LockedUntil)
+	}
+
+	// always run the hash comparison, even for unknown phone numbers, so the
+	// response time does not leak which phone numbers are registered. A
+	// deactivated user is handled like an unknown one.
+	known := output.Id != 0 && output.DeactivatedAt == nil
+	hashed := output.Password
+	if !known {
+		hashed = s.passwordHasher.DummyHash()
+	}
+	match, needsRehash, err := s.passwordHasher.Verify(password, hashed, output.Salt)
+	if err != nil {
+		return repository.User{}, err
+	}
+	if !match || !known {
+		if known {
+			lockedUntil, err := s.Repository.IncrementFailedLogin(rctx, output.Id)
+			if err != nil {
+				return repository.User{}, err
+			}
+			if lockedUntil != nil {
+				return repository.User{}, accountLockedError(ctx, *lockedUntil)
+			}
+		}
+		return repository.User{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid phone number or password")
+	}
+
+	// the plain password is only known here, so hashes in the legacy format
+	// or with outdated parameters are upgraded on a successful login
+	if needsRehash {
+		if err := s.setPassword(rctx, output.Id, password); err != nil {
+			ctx.Logger().Errorf("failed to rehash password of user %d: %v", output.Id, err)
+		}
+	}
+
+	return output, nil
+}
+
+const (
+	loginOTPCodeLength      = 6
+	loginOTPCodeTTL         = 5 * time.Minute
+	loginOTPResendCooldown  = time.Minute
+	loginOTPRateLimit       = 5
+	loginOTPRateLimitWindow = time.Hour
+	loginOTPMaxAttempts     = 5
+	loginOTPSendTimeout     = 30 * time.Second
+	loginOTPRequestAccepted = "if the phone number is registered, a login code has been sent to it"
+)
+
+func (s *Server) RequestUsersLoginOtp(ctx echo.Context) error {
 	var (
-		rctx        = ctx.Request().Context()
-		userId, err = util.GetUserIDFromContext(rctx)
+		req = generated.LoginOtpRequest{}
+		res = generated.MessageResponse{Message: loginOTPRequestAccepted}
 	)
 
+	err := ctx.Bind(&req)
 	if err != nil {
 		return err
 	}
 
-	user, err := s.Repository.FindUserById(rctx, userId)
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
 	if err != nil {
 		return err
 	}
 
-	res := &generated.GetProfileResponse{
-		FullName:    user.FullName,
-		PhoneNumber: user.PhoneNumber,
+	// the response is the same whether a code is sent or not and is sent
+	// before the code is, so neither its content nor its timing tells which
+	// numbers are registered or what the rate limits are
+	logger := ctx.Logger()
+	s.runInBackground(func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), loginOTPSendTimeout)
+		defer cancel()
+
+		err := s.sendLoginOTP(sendCtx, req.PhoneNumber)
+		if err != nil {
+			logger.Errorf("failed to send login code: %v", err)
+		}
+	})
+
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// sendLoginOTP sends a login code to the active user with the phone number,
+// if any, unless the rate limit is reached or a code was just sent.
+func (s *Server) sendLoginOTP(ctx context.Context, phoneNumber string) error {
+	user, err := s.Repository.FindUserByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 || user.Status() != repository.UserStatusActive {
+		return nil
 	}
 
-	return ctx.JSON(http.StatusOK, res)
+	sent, err := s.Repository.CountLoginOTPsSince(ctx, phoneNumber, time.Now().Add(-loginOTPRateLimitWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= loginOTPRateLimit {
+		return nil
+	}
+
+	active, err := s.Repository.FindActiveLoginOTP(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	if active.Id != 0 && time.Since(active.CreatedAt) < loginOTPResendCooldown {
+		return nil
+	}
+
+	code, err := s.random.Digits(loginOTPCodeLength)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.CreateLoginOTP(ctx, repository.CreateLoginOTPInput{
+		UserId:      user.Id,
+		PhoneNumber: phoneNumber,
+		CodeHash:    s.hashLoginOTP(user.Id, phoneNumber, code),
+		ExpiresAt:   time.Now().Add(loginOTPCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your SawitPro login code is %s. It expires in %d minutes.",
+		code, int(loginOTPCodeTTL.Minutes()))
+	err = s.smsSender.SendSMS(ctx, phoneNumber, message)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", user.Id, err)
+	}
+
+	return nil
 }
 
-func (s *Server) UpdateUsersProfile(ctx echo.Context, _ generated.UpdateUsersProfileParams) error {
+func (s *Server) VerifyUsersLoginOtp(ctx echo.Context) error {
 	var (
-		req         = generated.UpdateUsersProfileJSONRequestBody{}
-		res         = generated.RegisterProfileResponse{}
-		rctx        = ctx.Request().Context()
-		userId, err = util.GetUserIDFromContext(rctx)
+		req        = generated.LoginOtpVerifyRequest{}
+		rctx       = ctx.Request().Context()
+		invalidErr = echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired login code")
 	)
 
+	err := ctx.Bind(&req)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.Bind(&req)
+	err = validateDeviceLabel(req.DeviceLabel)
 	if err != nil {
 		return err
 	}
 
-	if req.PhoneNumber == nil && req.FullName == nil {
-		return ctx.JSON(http.StatusNoContent, nil)
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return err
 	}
-	if req.PhoneNumber != nil {
-		if err := util.ValidatePhoneNumber(*req.PhoneNumber); err != nil {
-			return err
-		}
 
-		output, err := s.Repository.FindUserByPhoneNumber(rctx, *req.PhoneNumber)
-		if err != nil {
-			return err
-		}
-		if output.Id != 0 && output.Id != userId {
-			return echo.NewHTTPError(http.StatusConflict, "phone number already existed")
-		}
+	user, err := s.Repository.FindUserByPhoneNumber(rctx, req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 || user.DeactivatedAt != nil {
+		return invalidErr
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return accountLockedError(ctx, *user.LockedUntil)
 	}
 
-	_, err = s.Repository.FindUserById(rctx, userId)
+	otp, err := s.Repository.FindActiveLoginOTP(rctx, req.PhoneNumber)
 	if err != nil {
 		return err
 	}
+	if otp.Id == 0 || otp.UserId != user.Id || otp.Attempts >= loginOTPMaxAttempts {
+		return invalidErr
+	}
 
-	err = s.Repository.UpdateUser(rctx, req.FullName, req.PhoneNumber, userId)
+	attempts, err := s.Repository.IncrementLoginOTPAttempts(rctx, otp.Id)
 	if err != nil {
 		return err
 	}
+	if attempts > loginOTPMaxAttempts ||
+		subtle.ConstantTimeCompare([]byte(s.hashLoginOTP(user.Id, req.PhoneNumber, req.Code)), []byte(otp.CodeHash)) != 1 {
+		return invalidErr
+	}
 
-	res.Id = userId
+	consumed, err := s.Repository.ConsumeLoginOTP(rctx, otp.Id)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return invalidErr
+	}
+
+	// the code only proves the user has the phone, which does not replace
+	// the authenticator as the second factor
+	authenticator, err := s.Repository.FindTOTP(rctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if authenticator.ConfirmedAt != nil {
+		return s.startMFAChallenge(ctx, user.Id, req.DeviceLabel)
+	}
+
+	err = s.Repository.IncrementSuccessfulLogin(rctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.startSession(ctx, user.Id, req.DeviceLabel)
+	if err != nil {
+		return err
+	}
 
 	return ctx.JSON(http.StatusOK, res)
 }
 
-func (s *Server) CreateUsersProfile(ctx echo.Context) error {
+// hashLoginOTP keys the hash with codeHashKey, since a six digit code hashed
+// without a key is found by trying every code.
+func (s *Server) hashLoginOTP(userId int64, phoneNumber, code string) string {
+	return util.HashCode(s.codeHashKey, strconv.FormatInt(userId, 10)+":"+phoneNumber+":"+code)
+}
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	totpIssuer              = "SawitPro"
+	// totpSkew is the number of 30 second steps a code may be off by, to
+	// allow for clock drift of the device
+	totpSkew = 1
+	// recovery codes are typed in by hand, so they are made of digits shown
+	// in groups of recoveryCodeGroupLength
+	recoveryCodeCount       = 10
+	recoveryCodeLength      = 12
+	recoveryCodeGroupLength = 4
+)
+
+// startMFAChallenge responds with a challenge token that is exchanged for
+// tokens at VerifyUsersLoginMfa together with a code of the authenticator.
+func (s *Server) startMFAChallenge(ctx echo.Context, userId int64, deviceLabel *string) error {
+	var label string
+	if deviceLabel != nil {
+		label = *deviceLabel
+	}
+
+	token, err := s.createMFAChallenge(ctx.Request().Context(), userId, label)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.MfaChallengeResponse{
+		MfaRequired: true,
+		MfaToken:    token,
+		ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// createMFAChallenge returns the token of a new challenge of the user.
+func (s *Server) createMFAChallenge(ctx context.Context, userId int64, deviceLabel string) (string, error) {
+	token, err := s.random.Token(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Repository.CreateMFAChallenge(ctx, repository.CreateMFAChallengeInput{
+		UserId:      userId,
+		TokenHash:   util.HashToken(token),
+		DeviceLabel: deviceLabel,
+		ExpiresAt:   time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *Server) VerifyUsersLoginMfa(ctx echo.Context) error {
 	var (
-		req  = generated.RegisterProfileRequest{}
-		res  = generated.RegisterProfileResponse{}
+		req  = generated.MfaLoginRequest{}
 		rctx = ctx.Request().Context()
 	)
 
@@ -122,23 +373,2548 @@ func (s *Server) CreateUsersProfile(ctx echo.Context) error {
 		return err
 	}
 
-	if err := util.ValidatePhoneNumber(req.PhoneNumber); err != nil {
+	challenge, err := s.verifyMFAChallenge(ctx, req.MfaToken, req.Code)
+	if err != nil {
 		return err
 	}
 
-	createReq := repository.CreateUserInput{
-		FullName:    req.FullName,
-		PhoneNumber: req.PhoneNumber,
-		Password:    req.Password,
-		Salt:        util.RandomSalt(),
+	err = s.Repository.IncrementSuccessfulLogin(rctx, challenge.UserId)
+	if err != nil {
+		return err
 	}
-	createReq.Password = util.HashPassword(req.Password + ":" + createReq.Salt)
 
-	output, err := s.Repository.CreateUser(rctx, createReq)
+	res, err := s.startSession(ctx, challenge.UserId, &challenge.DeviceLabel)
 	if err != nil {
 		return err
 	}
 
-	res.Id = output.Id
 	return ctx.JSON(http.StatusOK, res)
 }
+
+var errInvalidMFAToken = echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired mfa token")
+
+// verifyMFAChallenge consumes the challenge of the token when the code of the
+// authenticator app or a recovery code is valid, counting an invalid code as
+// a failed login towards the lockout.
+func (s *Server) verifyMFAChallenge(ctx echo.Context, token, code string) (repository.MFAChallenge, error) {
+	rctx := ctx.Request().Context()
+
+	challenge, err := s.Repository.FindActiveMFAChallenge(rctx, util.HashToken(token))
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	if challenge.Id == 0 || challenge.Attempts >= mfaChallengeMaxAttempts {
+		return repository.MFAChallenge{}, errInvalidMFAToken
+	}
+
+	user, err := s.Repository.FindUserById(rctx, challenge.UserId)
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	// the user may have been deactivated since the password was verified
+	if user.DeactivatedAt != nil {
+		return repository.MFAChallenge{}, errInvalidMFAToken
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return repository.MFAChallenge{}, accountLockedError(ctx, *user.LockedUntil)
+	}
+
+	attempts, err := s.Repository.IncrementMFAChallengeAttempts(rctx, challenge.Id)
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	if attempts > mfaChallengeMaxAttempts {
+		return repository.MFAChallenge{}, errInvalidMFAToken
+	}
+
+	authenticator, err := s.Repository.FindTOTP(rctx, user.Id)
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	if authenticator.ConfirmedAt == nil {
+		return repository.MFAChallenge{}, errInvalidMFAToken
+	}
+
+	// a recovery code is accepted in place of a code of the authenticator,
+	// the two are told apart by their length
+	var valid bool
+	if len(code) == totp.Digits {
+		valid, err = s.useTOTPCode(rctx, authenticator, code)
+	} else {
+		valid, err = s.useRecoveryCode(ctx, user.Id, code)
+	}
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	if !valid {
+		lockedUntil, err := s.Repository.IncrementFailedLogin(rctx, user.Id)
+		if err != nil {
+			return repository.MFAChallenge{}, err
+		}
+		if lockedUntil != nil {
+			return repository.MFAChallenge{}, accountLockedError(ctx, *lockedUntil)
+		}
+		return repository.MFAChallenge{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor authentication code")
+	}
+
+	consumed, err := s.Repository.ConsumeMFAChallenge(rctx, challenge.Id)
+	if err != nil {
+		return repository.MFAChallenge{}, err
+	}
+	if !consumed {
+		return repository.MFAChallenge{}, errInvalidMFAToken
+	}
+
+	return challenge, nil
+}
+
+// GetJwks publishes the keys access tokens are verified with, so that other
+// services can verify them without sharing key files.
+func (s *Server) GetJwks(ctx echo.Context) error {
+	var res = generated.JwksResponse{Keys: []generated.Jwk{}}
+
+	for _, key := range s.jwt.PublicKeys() {
+		res.Keys = append(res.Keys, generated.Jwk{
+			Kty: key.KeyType,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			Kid: key.KeyID,
+			N:   util.NilIfZero(key.N),
+			E:   util.NilIfZero(key.E),
+			Crv: util.NilIfZero(key.Curve),
+			X:   util.NilIfZero(key.X),
+			Y:   util.NilIfZero(key.Y),
+		})
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// GetOpenidConfiguration lets OpenID Connect libraries configure themselves
+// from the issuer alone, see OpenID Connect Discovery section 3.
+func (s *Server) GetOpenidConfiguration(ctx echo.Context) error {
+	var (
+		issuer     = s.jwt.Issuer()
+		baseURL    = strings.TrimSuffix(issuer, "/")
+		algorithms = []string{}
+	)
+
+	for _, key := range s.jwt.PublicKeys() {
+		if !util.In(key.Algorithm, algorithms...) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(http.StatusOK, generated.OpenidConfiguration{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            baseURL + "/v1/oauth/authorize",
+		TokenEndpoint:                    baseURL + "/v1/oauth/token",
+		UserinfoEndpoint:                 baseURL + "/v1/oauth/userinfo",
+		JwksUri:                          baseURL + "/.well-known/jwks.json",
+		ResponseTypesSupported:           []string{oauthResponseTypeCode},
+		SubjectTypesSupported:            []string{"public"},
+		IdTokenSigningAlgValuesSupported: algorithms,
+		ScopesSupported:                  []string{oidcScopeOpenID, oidcScopeProfile, oidcScopePhone},
+		GrantTypesSupported: []string{
+			string(generated.AuthorizationCode), string(generated.RefreshToken), string(generated.ClientCredentials),
+		},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "phone_number", "phone_number_verified",
+		},
+	})
+}
+
+const (
+	oauthScopeIntrospect  = "introspect"
+	oauthResponseTypeCode = "code"
+	oidcScopeOpenID       = "openid"
+	oidcScopeProfile      = "profile"
+	oidcScopePhone        = "phone"
+	// authorizationCodeTTL is how long a client has to exchange a code, it
+	// does so right after the user is redirected back to it
+	authorizationCodeTTL = time.Minute
+	pkceMethodS256       = "S256"
+	// pkceChallengeLength is the length of a base64url encoded SHA-256 digest
+	// without padding, see RFC 7636 section 4.2
+	pkceChallengeLength = 43
+)
+
+// CreateOauthToken issues tokens to a client, either of its own with the
+// client_credentials grant or of a user who signed in to it with the
+// authorization_code grant, see RFC 6749 sections 4.1, 4.4 and 6.
+func (s *Server) CreateOauthToken(ctx echo.Context) error {
+	grantType := generated.OAuthTokenRequestGrantType(ctx.FormValue("grant_type"))
+
+	// a public client has no secret, so it can only use the grants whose
+	// tokens belong to a user that signed in to it
+	client, err := s.authenticateClient(ctx, grantType != generated.ClientCredentials)
+	if err != nil {
+		return err
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	switch grantType {
+	case generated.ClientCredentials:
+		return s.createClientToken(ctx, client)
+	case generated.AuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client)
+	case generated.RefreshToken:
+		return s.refreshOauthToken(ctx, client)
+	}
+
+	return oauthError(http.StatusBadRequest, "unsupported_grant_type",
+		"grant_type must be one of authorization_code, refresh_token or client_credentials")
+}
+
+// createClientToken gives backend jobs an identity of their own.
+func (s *Server) createClientToken(ctx echo.Context, client repository.OAuthClient) error {
+	scopes := client.Scopes
+	if requested := strings.Fields(ctx.FormValue("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !util.In(scope, client.Scopes...) {
+				return oauthError(http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for the client")
+			}
+		}
+		scopes = requested
+	}
+
+	token, err := s.jwt.CreateClientToken(client.ClientId, scopes)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.jwt.AccessTokenTTL().Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// exchangeAuthorizationCode starts a session of the user who signed in at
+// SubmitOauthAuthorize for the client that requested the code.
+func (s *Server) exchangeAuthorizationCode(ctx echo.Context, client repository.OAuthClient) error {
+	var (
+		rctx       = ctx.Request().Context()
+		invalidErr = oauthError(http.StatusBadRequest, "invalid_grant", "the authorization code is invalid or expired")
+	)
+
+	code, err := s.Repository.ConsumeAuthorizationCode(rctx, util.HashToken(ctx.FormValue("code")))
+	if err != nil {
+		return err
+	}
+	if code.UserId == 0 || code.ClientId != client.ClientId || code.RedirectURI != ctx.FormValue("redirect_uri") ||
+		!verifyCodeChallenge(code.CodeChallenge, ctx.FormValue("code_verifier")) {
+		return invalidErr
+	}
+
+	user, err := s.Repository.FindUserById(rctx, code.UserId)
+	if err != nil {
+		return err
+	}
+	// the user may have been deactivated since the code was issued
+	if user.DeactivatedAt != nil {
+		return invalidErr
+	}
+
+	session := repository.CreateSessionInput{
+		Id:          s.random.UUID(),
+		UserId:      user.Id,
+		UserAgent:   ctx.Request().UserAgent(),
+		IpAddress:   ctx.RealIP(),
+		DeviceLabel: client.ClientId,
+		ClientId:    client.ClientId,
+		Scope:       code.Scope,
+	}
+	err = s.Repository.CreateSession(rctx, session)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := s.issueTokens(rctx, user.Id, session.Id, session.ClientId, session.Scope)
+	if err != nil {
+		return err
+	}
+
+	claims := userClaims(user, strings.Fields(code.Scope))
+	claims.Nonce = code.Nonce
+	claims.AuthTime = code.CreatedAt.Unix()
+	idToken, err := s.jwt.CreateIDToken(user.Id, client.ClientId, claims)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		Scope:        code.Scope,
+		RefreshToken: &tokens.RefreshToken,
+		IdToken:      &idToken,
+	})
+}
+
+// refreshOauthToken renews the tokens of a session the client started with
+// the authorization_code grant.
+func (s *Server) refreshOauthToken(ctx echo.Context, client repository.OAuthClient) error {
+	var (
+		rctx       = ctx.Request().Context()
+		invalidErr = oauthError(http.StatusBadRequest, "invalid_grant", "the refresh token is invalid or expired")
+	)
+
+	token, err := s.useRefreshToken(rctx, ctx.FormValue("refresh_token"))
+	if err == errInvalidRefreshToken {
+		return invalidErr
+	}
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Repository.FindSession(rctx, token.FamilyId)
+	if err != nil {
+		return err
+	}
+	if session.Id == "" || session.ClientId != client.ClientId {
+		return invalidErr
+	}
+
+	tokens, err := s.issueTokens(rctx, token.UserId, token.FamilyId, session.ClientId, session.Scope)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		Scope:        session.Scope,
+		RefreshToken: &tokens.RefreshToken,
+	})
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the S256 code
+// challenge of the authorization request, see RFC 7636 section 4.6.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// IntrospectOauthToken lets other services check a token with one call
+// instead of verifying it themselves, see RFC 7662.
+func (s *Server) IntrospectOauthToken(ctx echo.Context) error {
+	var (
+		rctx  = ctx.Request().Context()
+		token = ctx.FormValue("token")
+	)
+
+	client, err := s.authenticateClient(ctx, false)
+	if err != nil {
+		return err
+	}
+	if !util.In(oauthScopeIntrospect, client.Scopes...) {
+		return oauthError(http.StatusForbidden, "insufficient_scope", "the client is not allowed to introspect tokens")
+	}
+
+	if token == "" {
+		return oauthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	// the hint only decides which kind of token is looked up first
+	lookups := []func(context.Context, string) (generated.IntrospectionResponse, error){
+		s.introspectAccessToken, s.introspectRefreshToken,
+	}
+	if ctx.FormValue("token_type_hint") == string(generated.IntrospectionRequestTokenTypeHintRefreshToken) {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	for _, lookup := range lookups {
+		res, err := lookup(rctx, token)
+		if err != nil {
+			return err
+		}
+		if res.Active {
+			return ctx.JSON(http.StatusOK, res)
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, generated.IntrospectionResponse{Active: false})
+}
+
+// introspectAccessToken reports a valid access token that was not revoked
+// as active.
+func (s *Server) introspectAccessToken(ctx context.Context, token string) (res generated.IntrospectionResponse, err error) {
+	claims, err := s.jwt.ParseWithClaims(token)
+	if err != nil {
+		return res, nil
+	}
+
+	if s.revocation != nil {
+		revoked, err := s.revocation.IsRevoked(ctx, claims)
+		if err != nil || revoked {
+			return res, err
+		}
+	}
+
+	tokenType := generated.IntrospectionResponseTokenTypeAccessToken
+	res = generated.IntrospectionResponse{
+		Active:    true,
+		TokenType: &tokenType,
+		Sub:       util.NilIfZero(claims.Subject),
+		Sid:       util.NilIfZero(claims.SessionId),
+		ClientId:  util.NilIfZero(claims.ClientId),
+		Scope:     util.NilIfZero(claims.Scope),
+		Iss:       util.NilIfZero(claims.Issuer),
+		Jti:       util.NilIfZero(claims.ID),
+	}
+	if len(claims.Audience) > 0 {
+		res.Aud = &claims.Audience[0]
+	}
+	if claims.ExpiresAt != nil {
+		res.Exp = util.NilIfZero(claims.ExpiresAt.Unix())
+	}
+	if claims.IssuedAt != nil {
+		res.Iat = util.NilIfZero(claims.IssuedAt.Unix())
+	}
+	if claims.NotBefore != nil {
+		res.Nbf = util.NilIfZero(claims.NotBefore.Unix())
+	}
+
+	return res, nil
+}
+
+// introspectRefreshToken reports a refresh token that can still be exchanged
+// for new tokens as active.
+func (s *Server) introspectRefreshToken(ctx context.Context, token string) (res generated.IntrospectionResponse, err error) {
+	refreshToken, err := s.Repository.FindRefreshTokenByHash(ctx, util.HashToken(token))
+	if err != nil {
+		return
+	}
+	if refreshToken.Id == 0 || refreshToken.UsedAt != nil || refreshToken.RevokedAt != nil ||
+		!refreshToken.ExpiresAt.After(time.Now()) {
+		return res, nil
+	}
+
+	tokenType := generated.IntrospectionResponseTokenTypeRefreshToken
+	return generated.IntrospectionResponse{
+		Active:    true,
+		TokenType: &tokenType,
+		Sub:       util.NilIfZero(strconv.FormatInt(refreshToken.UserId, 10)),
+		Sid:       util.NilIfZero(refreshToken.FamilyId),
+		Exp:       util.NilIfZero(refreshToken.ExpiresAt.Unix()),
+	}, nil
+}
+
+// authenticateClient checks the credentials of the client calling an OAuth
+// endpoint, given with HTTP Basic authentication or as the client_id and
+// client_secret parameters, see RFC 6749 section 2.3.1. A public client only
+// sends its client_id and is only accepted when allowPublic is set.
+func (s *Server) authenticateClient(ctx echo.Context, allowPublic bool) (repository.OAuthClient, error) {
+	clientId, clientSecret, ok := ctx.Request().BasicAuth()
+	if ok {
+		// the credentials are form encoded before they are put in the header
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = ctx.FormValue("client_id"), ctx.FormValue("client_secret")
+	}
+
+	invalidClient := func() error {
+		ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		return oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	if clientId == "" {
+		return repository.OAuthClient{}, invalidClient()
+	}
+
+	client, err := s.Repository.FindOAuthClient(ctx.Request().Context(), clientId)
+	if err != nil {
+		return repository.OAuthClient{}, err
+	}
+	if client.ClientId == "" {
+		return repository.OAuthClient{}, invalidClient()
+	}
+
+	if client.IsPublic() {
+		if !allowPublic || clientSecret != "" {
+			return repository.OAuthClient{}, invalidClient()
+		}
+		return client, nil
+	}
+
+	if clientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(util.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return repository.OAuthClient{}, invalidClient()
+	}
+
+	return client, nil
+}
+
+// oauthError returns an error in the format of RFC 6749 section 5.2.
+func oauthError(status int, code, description string) error {
+	return echo.NewHTTPError(status, generated.OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: &description,
+	})
+}
+
+// authorizationRequest holds the parameters of an authorization request,
+// which the login page passes on when it is submitted.
+type authorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func readAuthorizationRequest(ctx echo.Context) authorizationRequest {
+	return authorizationRequest{
+		ResponseType:        ctx.FormValue("response_type"),
+		ClientId:            ctx.FormValue("client_id"),
+		RedirectURI:         ctx.FormValue("redirect_uri"),
+		Scope:               ctx.FormValue("scope"),
+		State:               ctx.FormValue("state"),
+		Nonce:               ctx.FormValue("nonce"),
+		CodeChallenge:       ctx.FormValue("code_challenge"),
+		CodeChallengeMethod: ctx.FormValue("code_challenge_method"),
+	}
+}
+
+// authorizationRedirectError is an error of an authorization request that is
+// reported to the client by redirecting back to it, see RFC 6749 section
+// 4.1.2.1.
+type authorizationRedirectError struct {
+	code        string
+	description string
+}
+
+func (e authorizationRedirectError) Error() string { return e.code + ": " + e.description }
+
+// AuthorizeOauth shows the login page to a user a client sent to sign in,
+// see OpenID Connect Core section 3.1.2.
+func (s *Server) AuthorizeOauth(ctx echo.Context, _ generated.AuthorizeOauthParams) error {
+	req := readAuthorizationRequest(ctx)
+
+	_, err := s.checkAuthorizationRequest(ctx, req)
+	if err != nil {
+		return rejectAuthorizationRequest(ctx, req, err)
+	}
+
+	csrfToken, err := s.setAuthorizeCSRFCookie(ctx)
+	if err != nil {
+		return err
+	}
+
+	return renderAuthorizePage(ctx, http.StatusOK, authorizePage{Request: &req, CSRFToken: csrfToken})
+}
+
+// SubmitOauthAuthorize signs the user in with the login page and redirects
+// back to the client with an authorization code.
+func (s *Server) SubmitOauthAuthorize(ctx echo.Context) error {
+	var (
+		rctx = ctx.Request().Context()
+		req  = readAuthorizationRequest(ctx)
+		page = authorizePage{Request: &req, PhoneNumber: ctx.FormValue("phone_number")}
+	)
+
+	client, err := s.checkAuthorizationRequest(ctx, req)
+	if err != nil {
+		return rejectAuthorizationRequest(ctx, req, err)
+	}
+
+	// a form another site submits in the browser of the user, e.g. to sign
+	// it in to the account of the attacker, lacks the value of the cookie
+	page.CSRFToken = ctx.FormValue(authorizeCSRFField)
+	if !validAuthorizeCSRF(ctx, page.CSRFToken) {
+		page.CSRFToken, err = s.setAuthorizeCSRFCookie(ctx)
+		if err != nil {
+			return err
+		}
+		return renderAuthorizeError(ctx, errInvalidAuthorizeForm, page)
+	}
+
+	var userId int64
+	if mfaToken := ctx.FormValue("mfa_token"); mfaToken != "" {
+		challenge, err := s.verifyMFAChallenge(ctx, mfaToken, ctx.FormValue("code"))
+		if err != nil {
+			// the user starts over with the password once the challenge is
+			// no longer valid
+			if err != errInvalidMFAToken {
+				page.MFAToken = mfaToken
+			}
+			return renderAuthorizeError(ctx, err, page)
+		}
+		userId = challenge.UserId
+	} else {
+		user, err := s.verifyPassword(ctx, ctx.FormValue("phone_number"), ctx.FormValue("password"))
+		if err != nil {
+			return renderAuthorizeError(ctx, err, page)
+		}
+
+		// the failed login count is only reset once every factor is
+		// verified, as in UsersLogin
+		authenticator, err := s.Repository.FindTOTP(rctx, user.Id)
+		if err != nil {
+			return err
+		}
+		if authenticator.ConfirmedAt != nil {
+			page.MFAToken, err = s.createMFAChallenge(rctx, user.Id, client.ClientId)
+			if err != nil {
+				return err
+			}
+			return renderAuthorizePage(ctx, http.StatusOK, page)
+		}
+		userId = user.Id
+	}
+
+	err = s.Repository.IncrementSuccessfulLogin(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	code, err := s.random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.CreateAuthorizationCode(rctx, repository.CreateAuthorizationCodeInput{
+		CodeHash:      util.HashToken(code),
+		ClientId:      client.ClientId,
+		UserId:        userId,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return redirectToClient(ctx, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// checkAuthorizationRequest returns the client of a valid authorization
+// request. The redirect uri is only trusted once it is registered for the
+// client, so the errors found before are returned as *echo.HTTPError and
+// only the ones found after as authorizationRedirectError.
+func (s *Server) checkAuthorizationRequest(ctx echo.Context, req authorizationRequest) (repository.OAuthClient, error) {
+	client, err := s.Repository.FindOAuthClient(ctx.Request().Context(), req.ClientId)
+	if err != nil {
+		return repository.OAuthClient{}, err
+	}
+	if client.ClientId == "" {
+		return repository.OAuthClient{}, echo.NewHTTPError(http.StatusBadRequest, "unknown client")
+	}
+	if !util.In(req.RedirectURI, client.RedirectURIs...) {
+		return repository.OAuthClient{}, echo.NewHTTPError(http.StatusBadRequest, "redirect_uri is not registered for the client")
+	}
+
+	if req.ResponseType != oauthResponseTypeCode {
+		return client, authorizationRedirectError{"unsupported_response_type", "response_type must be code"}
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !util.In(oidcScopeOpenID, scopes...) {
+		return client, authorizationRedirectError{"invalid_scope", "scope must include openid"}
+	}
+	for _, scope := range scopes {
+		if !util.In(scope, client.Scopes...) {
+			return client, authorizationRedirectError{"invalid_scope", "scope " + scope + " is not allowed for the client"}
+		}
+	}
+
+	if req.CodeChallengeMethod != pkceMethodS256 || len(req.CodeChallenge) != pkceChallengeLength {
+		return client, authorizationRedirectError{"invalid_request", "a code_challenge with the S256 code_challenge_method is required"}
+	}
+
+	return client, nil
+}
+
+// rejectAuthorizationRequest redirects back to the client with the error, or
+// shows it on the page when the client can not be trusted to redirect to.
+func rejectAuthorizationRequest(ctx echo.Context, req authorizationRequest, err error) error {
+	var redirectErr authorizationRedirectError
+	if errors.As(err, &redirectErr) {
+		return redirectToClient(ctx, req.RedirectURI, url.Values{
+			"error":             {redirectErr.code},
+			"error_description": {redirectErr.description},
+			"state":             {req.State},
+		})
+	}
+
+	return renderAuthorizeError(ctx, err, authorizePage{})
+}
+
+// redirectToClient redirects the user agent to the redirect uri of the
+// client, adding the non-empty parameters to its query.
+func redirectToClient(ctx echo.Context, redirectURI string, params url.Values) error {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(name, value)
+			}
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return ctx.Redirect(http.StatusFound, target.String())
+}
+
+const (
+	// authorizeCSRFCookie holds the anti-CSRF value of the login page, which
+	// the form sends back in authorizeCSRFField
+	authorizeCSRFCookie = "oauth_csrf"
+	authorizeCSRFField  = "csrf_token"
+)
+
+var errInvalidAuthorizeForm = echo.NewHTTPError(http.StatusForbidden, "the form has expired, please sign in again")
+
+// setAuthorizeCSRFCookie sets a new anti-CSRF value of the login page and
+// returns it for the form.
+func (s *Server) setAuthorizeCSRFCookie(ctx echo.Context) (string, error) {
+	token, err := s.random.Token(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx.SetCookie(&http.Cookie{
+		Name:     authorizeCSRFCookie,
+		Value:    token,
+		Path:     "/v1/oauth/authorize",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// validAuthorizeCSRF reports whether the anti-CSRF value of the form matches
+// the one of the cookie.
+func validAuthorizeCSRF(ctx echo.Context, token string) bool {
+	cookie, err := ctx.Cookie(authorizeCSRFCookie)
+	if err != nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
+
+// authorizePage is the data of the login page of an authorization request.
+type authorizePage struct {
+	// Request is nil when the request is rejected without a redirect, the
+	// page then only shows the error
+	Request     *authorizationRequest
+	PhoneNumber string
+	// MFAToken is set once the password of a user with two-factor
+	// authentication enabled is verified, the page then asks for a code
+	MFAToken  string
+	CSRFToken string
+	Error     string
+}
+
+var authorizePageTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: .25rem 0 1rem; padding: .5rem; }
+button { padding: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Sign in</h1>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+{{with .Request}}
+<p>to continue to {{.ClientId}}</p>
+<form method="post" action="/v1/oauth/authorize">
+<input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+<input type="hidden" name="response_type" value="{{.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.ClientId}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.CodeChallengeMethod}}">
+{{if $.MFAToken}}
+<input type="hidden" name="mfa_token" value="{{$.MFAToken}}">
+<label for="code">Code of your authenticator app or a recovery code</label>
+<input id="code" name="code" autocomplete="one-time-code" required autofocus>
+{{else}}
+<label for="phone_number">Phone number</label>
+<input id="phone_number" name="phone_number" type="tel" value="{{$.PhoneNumber}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+{{end}}
+<button type="submit">Sign in</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+func renderAuthorizePage(ctx echo.Context, status int, page authorizePage) error {
+	var buf bytes.Buffer
+	err := authorizePageTemplate.Execute(&buf, page)
+	if err != nil {
+		return err
+	}
+
+	// the page takes a password, so it is neither cached nor framed
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set(echo.HeaderXFrameOptions, "DENY")
+	header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	return ctx.HTMLBlob(status, buf.Bytes())
+}
+
+// renderAuthorizeError shows the message of a client error on the page, other
+// errors are left to the error handler.
+func renderAuthorizeError(ctx echo.Context, err error, page authorizePage) error {
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code >= http.StatusInternalServerError {
+		return err
+	}
+
+	page.Error = fmt.Sprint(httpErr.Message)
+	if res, ok := httpErr.Message.(generated.ErrorResponse); ok {
+		page.Error = res.Message
+	}
+
+	return renderAuthorizePage(ctx, httpErr.Code, page)
+}
+
+// GetOauthUserinfo returns the claims about the user that the session of the
+// access token grants, see OpenID Connect Core section 5.3.
+func (s *Server) GetOauthUserinfo(ctx echo.Context, _ generated.GetOauthUserinfoParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	claims, err := util.GetClaimsFromContext(rctx)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Repository.FindSession(rctx, claims.SessionId)
+	if err != nil {
+		return err
+	}
+	if session.Id == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "session has been revoked")
+	}
+
+	// a login to this service itself is not limited to the scopes granted
+	// to a client
+	scopes := []string{oidcScopeProfile, oidcScopePhone}
+	if session.ClientId != "" {
+		scopes = strings.Fields(session.Scope)
+	}
+
+	user, err := s.Repository.FindUserById(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	info := userClaims(user, scopes)
+	return ctx.JSON(http.StatusOK, generated.UserinfoResponse{
+		Sub:                 strconv.FormatInt(user.Id, 10),
+		Name:                util.NilIfZero(info.Name),
+		PhoneNumber:         util.NilIfZero(info.PhoneNumber),
+		PhoneNumberVerified: info.PhoneNumberVerified,
+	})
+}
+
+// userClaims returns the claims about the user that the scopes grant.
+func userClaims(user repository.User, scopes []string) jwt.IDTokenClaims {
+	var claims jwt.IDTokenClaims
+
+	if util.In(oidcScopeProfile, scopes...) {
+		claims.Name = user.FullName
+	}
+	if util.In(oidcScopePhone, scopes...) {
+		verified := user.PhoneVerifiedAt != nil
+		claims.PhoneNumber, claims.PhoneNumberVerified = user.PhoneNumber, &verified
+	}
+
+	return claims
+}
+
+func (s *Server) RefreshUsersToken(ctx echo.Context) error {
+	var (
+		req  = generated.RefreshTokenRequest{}
+		rctx = ctx.Request().Context()
+	)
+
+	err := ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.useRefreshToken(rctx, req.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Repository.FindSession(rctx, token.FamilyId)
+	if err != nil {
+		return err
+	}
+	// the refresh tokens of a client are only renewed at /v1/oauth/token,
+	// where the client authenticates
+	if session.Id == "" || session.ClientId != "" {
+		return errInvalidRefreshToken
+	}
+
+	res, err := s.issueTokens(rctx, token.UserId, token.FamilyId, "", "")
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+var errInvalidRefreshToken = echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token")
+
+// useRefreshToken marks the refresh token as used, so that new tokens can be
+// issued for its session exactly once.
+func (s *Server) useRefreshToken(ctx context.Context, refreshToken string) (repository.RefreshToken, error) {
+	token, err := s.Repository.FindRefreshTokenByHash(ctx, util.HashToken(refreshToken))
+	if err != nil {
+		return repository.RefreshToken{}, err
+	}
+	if token.Id == 0 || token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return repository.RefreshToken{}, errInvalidRefreshToken
+	}
+
+	marked := false
+	if token.UsedAt == nil {
+		marked, err = s.Repository.MarkRefreshTokenUsed(ctx, token.Id)
+		if err != nil {
+			return repository.RefreshToken{}, err
+		}
+	}
+
+	// a refresh token presented twice means it has leaked, so every token
+	// issued from the same login is revoked, access tokens included
+	if !marked {
+		err = s.Repository.RevokeRefreshTokenFamily(ctx, token.FamilyId)
+		if err != nil {
+			return repository.RefreshToken{}, err
+		}
+		err = s.revokeSessionTokens(ctx, token.FamilyId)
+		if err != nil {
+			return repository.RefreshToken{}, err
+		}
+		return repository.RefreshToken{}, errInvalidRefreshToken
+	}
+
+	err = s.Repository.TouchSession(ctx, token.FamilyId)
+	if err != nil {
+		return repository.RefreshToken{}, err
+	}
+
+	return token, nil
+}
+
+func (s *Server) UsersLogout(ctx echo.Context, _ generated.UsersLogoutParams) error {
+	rctx := ctx.Request().Context()
+
+	// a client token has no user to log out
+	_, err := util.GetUserIDFromContext(rctx)
+	if err != nil {
+		return err
+	}
+
+	claims, err := util.GetClaimsFromContext(rctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.revocation.RevokeToken(rctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+
+	if claims.SessionId != "" {
+		err = s.Repository.RevokeRefreshTokenFamily(rctx, claims.SessionId)
+		if err != nil {
+			return err
+		}
+
+		// other access tokens refreshed for the session end with it
+		err = s.revokeSessionTokens(rctx, claims.SessionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) UsersLogoutAll(ctx echo.Context, _ generated.UsersLogoutAllParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeUserTokens(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) ListUsersSessions(ctx echo.Context, _ generated.ListUsersSessionsParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+		res         = generated.SessionListResponse{Sessions: []generated.Session{}}
+	)
+
+	if err != nil {
+		return err
+	}
+
+	claims, err := util.GetClaimsFromContext(rctx)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := s.Repository.ListActiveSessions(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		res.Sessions = append(res.Sessions, generated.Session{
+			Id:          session.Id,
+			DeviceLabel: session.DeviceLabel,
+			UserAgent:   session.UserAgent,
+			IpAddress:   session.IpAddress,
+			CreatedAt:   session.CreatedAt,
+			LastSeenAt:  session.LastSeenAt,
+			Current:     session.Id == claims.SessionId,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+func (s *Server) DeleteUsersSession(ctx echo.Context, id string, _ generated.DeleteUsersSessionParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.RevokeSession(rctx, userId, id)
+	if err != nil {
+		return err
+	}
+
+	// access tokens already issued for the session stay valid until they
+	// expire unless the session itself is revoked
+	err = s.revocation.RevokeToken(rctx, id, time.Now().Add(s.jwt.AccessTokenTTL()+time.Minute))
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) GetUsersProfile(ctx echo.Context, params generated.GetUsersProfileParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserById(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	res := &generated.GetProfileResponse{
+		FullName:      user.FullName,
+		PhoneNumber:   user.PhoneNumber,
+		PhoneVerified: user.PhoneVerifiedAt != nil,
+	}
+
+	if params.IncludeLoginStats != nil && *params.IncludeLoginStats {
+		res.LoginStats = &generated.LoginStats{
+			SuccessfulLoginCount: user.SuccessfulLoginCount,
+			FailedLoginCount:     user.FailedLoginCount,
+			LastLoginAt:          user.LastLoginAt,
+			LastFailedLoginAt:    user.LastFailedLoginAt,
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+func (s *Server) UpdateUsersProfile(ctx echo.Context, _ generated.UpdateUsersProfileParams) error {
+	var (
+		req         = generated.UpdateUsersProfileJSONRequestBody{}
+		res         = generated.UpdateProfileResponse{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	if req.PhoneNumber == nil && req.FullName == nil {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	if req.PhoneNumber != nil {
+		*req.PhoneNumber, err = s.normalizePhoneNumber(*req.PhoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	user, err := s.Repository.FindUserById(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if req.PhoneNumber != nil && *req.PhoneNumber == user.PhoneNumber {
+		req.PhoneNumber = nil
+	}
+	if req.PhoneNumber != nil {
+		// the phone number is what the user signs in with, so a stolen
+		// access token alone must not be enough to take the account over
+		if req.CurrentPassword == nil || *req.CurrentPassword == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "current_password is required to change the phone number")
+		}
+		err = s.verifyCurrentPassword(ctx, user, *req.CurrentPassword)
+		if err != nil {
+			return err
+		}
+
+		output, err := s.Repository.FindUserByPhoneNumber(rctx, *req.PhoneNumber)
+		if err != nil {
+			return err
+		}
+		if output.Id != 0 && output.Id != userId {
+			return echo.NewHTTPError(http.StatusConflict, "phone number already existed")
+		}
+	}
+
+	// the phone number identifies the user on login, so a new one only takes
+	// effect once the user proves to own it, see VerifyUsersPhone. It is
+	// requested first, so a rejected request, e.g. over the rate limit, does
+	// not change the full name either.
+	if req.PhoneNumber != nil {
+		err = s.sendPhoneVerification(rctx, userId, *req.PhoneNumber)
+		if err != nil {
+			return err
+		}
+		res.PendingPhoneNumber = req.PhoneNumber
+	}
+
+	if req.FullName != nil {
+		err = s.Repository.UpdateUser(rctx, req.FullName, nil, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	res.Id = userId
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+const (
+	phoneVerificationCodeLength     = 6
+	phoneVerificationCodeTTL        = 10 * time.Minute
+	phoneVerificationResendCooldown = time.Minute
+	phoneVerificationRateLimit      = 5
+	phoneVerificationRateWindow     = time.Hour
+	phoneVerificationMaxAttempts    = 5
+)
+
+var errPhoneVerificationRateLimited = echo.NewHTTPError(http.StatusTooManyRequests, "too many verification codes requested, try again later")
+
+func (s *Server) VerifyUsersPhone(ctx echo.Context, _ generated.VerifyUsersPhoneParams) error {
+	var (
+		req         = generated.PhoneVerificationRequest{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+		invalidErr  = echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification code")
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	verification, err := s.Repository.FindActivePhoneVerification(rctx, userId)
+	if err != nil {
+		return err
+	}
+	if verification.Id == 0 || verification.Attempts >= phoneVerificationMaxAttempts {
+		return invalidErr
+	}
+
+	attempts, err := s.Repository.IncrementPhoneVerificationAttempts(rctx, verification.Id)
+	if err != nil {
+		return err
+	}
+	expectedHash := s.hashPhoneVerificationCode(userId, verification.PhoneNumber, req.Code)
+	if attempts > phoneVerificationMaxAttempts ||
+		subtle.ConstantTimeCompare([]byte(expectedHash), []byte(verification.CodeHash)) != 1 {
+		return invalidErr
+	}
+
+	confirmed, err := s.Repository.ConfirmPhoneVerification(rctx, verification.Id)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return invalidErr
+	}
+
+	// the new phone number signs in from now on, so only the session that
+	// changed it is kept
+	claims, err := util.GetClaimsFromContext(rctx)
+	if err != nil {
+		return err
+	}
+	err = s.revokeOtherSessions(rctx, userId, claims.SessionId)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// sendPhoneVerification sends a code to the phone number that verifies it as
+// the phone number of the user. A code that was just sent to the same number
+// is not sent again, and only a few codes are sent per user within the rate
+// limit window, whatever the number.
+func (s *Server) sendPhoneVerification(ctx context.Context, userId int64, phoneNumber string) error {
+	active, err := s.Repository.FindActivePhoneVerification(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if active.Id != 0 && active.PhoneNumber == phoneNumber &&
+		time.Since(active.CreatedAt) < phoneVerificationResendCooldown {
+		return nil
+	}
+
+	sent, err := s.Repository.CountPhoneVerificationsSince(ctx, userId, time.Now().Add(-phoneVerificationRateWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= phoneVerificationRateLimit {
+		return errPhoneVerificationRateLimited
+	}
+
+	code, err := s.random.Digits(phoneVerificationCodeLength)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.CreatePhoneVerification(ctx, repository.CreatePhoneVerificationInput{
+		UserId:      userId,
+		PhoneNumber: phoneNumber,
+		CodeHash:    s.hashPhoneVerificationCode(userId, phoneNumber, code),
+		ExpiresAt:   time.Now().Add(phoneVerificationCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your SawitPro verification code is %s. It expires in %d minutes.",
+		code, int(phoneVerificationCodeTTL.Minutes()))
+	return s.smsSender.SendSMS(ctx, phoneNumber, message)
+}
+
+// hashPhoneVerificationCode binds the code to the phone number it was sent
+// to, so it can not verify any other number. Like the login codes, it is
+// keyed with codeHashKey.
+func (s *Server) hashPhoneVerificationCode(userId int64, phoneNumber, code string) string {
+	return util.HashCode(s.codeHashKey, strconv.FormatInt(userId, 10)+":"+phoneNumber+":"+code)
+}
+
+var errMFANotConfigured = echo.NewHTTPError(http.StatusServiceUnavailable, "two-factor authentication is not configured")
+
+func (s *Server) EnrollUsersTotp(ctx echo.Context, _ generated.EnrollUsersTotpParams) error {
+	var (
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if s.mfaSecrets == nil {
+		return errMFANotConfigured
+	}
+
+	user, err := s.Repository.FindUserById(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := s.mfaSecrets.Seal([]byte(secret))
+	if err != nil {
+		return err
+	}
+
+	saved, err := s.Repository.SaveTOTPSecret(rctx, userId, sealed)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	recoveryCodes, err := s.generateRecoveryCodes(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.TotpEnrollmentResponse{
+		Secret:        secret,
+		OtpauthUri:    totp.URI(totpIssuer, user.PhoneNumber, secret),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (s *Server) ConfirmUsersTotp(ctx echo.Context, _ generated.ConfirmUsersTotpParams) error {
+	var (
+		req         = generated.TotpCodeRequest{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	authenticator, err := s.Repository.FindTOTP(rctx, userId)
+	if err != nil {
+		return err
+	}
+	if authenticator.UserId == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no authenticator app is being enrolled")
+	}
+	if authenticator.ConfirmedAt != nil {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	step, valid, err := s.checkTOTPCode(authenticator, req.Code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code")
+	}
+
+	err = s.Repository.ConfirmTOTP(rctx, userId, step)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) DisableUsersTotp(ctx echo.Context, _ generated.DisableUsersTotpParams) error {
+	var (
+		req         = generated.TotpCodeRequest{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	authenticator, err := s.Repository.FindTOTP(rctx, userId)
+	if err != nil {
+		return err
+	}
+	if authenticator.ConfirmedAt == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "two-factor authentication is not enabled")
+	}
+
+	valid, err := s.useTOTPCode(rctx, authenticator, req.Code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code")
+	}
+
+	err = s.Repository.DeleteTOTP(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// checkTOTPCode validates the code against the secret of the authenticator,
+// rejecting codes that are not newer than the last accepted one.
+func (s *Server) checkTOTPCode(authenticator repository.TOTP, code string) (step int64, valid bool, err error) {
+	if s.mfaSecrets == nil {
+		return 0, false, errMFANotConfigured
+	}
+
+	secret, err := s.mfaSecrets.Open(authenticator.Secret)
+	if err != nil {
+		return
+	}
+
+	step, valid, err = totp.Validate(string(secret), code, time.Now(), totpSkew)
+	if err != nil || !valid {
+		return
+	}
+
+	return step, step > authenticator.LastUsedStep, nil
+}
+
+// useTOTPCode validates the code and records it as used, so that a code can
+// not be used twice, even by concurrent requests.
+func (s *Server) useTOTPCode(ctx context.Context, authenticator repository.TOTP, code string) (bool, error) {
+	step, valid, err := s.checkTOTPCode(authenticator, code)
+	if err != nil || !valid {
+		return false, err
+	}
+
+	return s.Repository.UseTOTPStep(ctx, authenticator.UserId, step)
+}
+
+func (s *Server) RegenerateUsersRecoveryCodes(ctx echo.Context, _ generated.RegenerateUsersRecoveryCodesParams) error {
+	var (
+		req         = generated.TotpCodeRequest{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	authenticator, err := s.Repository.FindTOTP(rctx, userId)
+	if err != nil {
+		return err
+	}
+	if authenticator.ConfirmedAt == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "two-factor authentication is not enabled")
+	}
+
+	// recovery codes bypass the second factor, so the access token alone is
+	// not enough to replace them
+	valid, err := s.useTOTPCode(rctx, authenticator, req.Code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code")
+	}
+
+	recoveryCodes, err := s.generateRecoveryCodes(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, userId, userId, auditActionRecoveryCodesRegenerated)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user, returning
+// the new codes formatted for display. Only their hashes are stored.
+func (s *Server) generateRecoveryCodes(ctx context.Context, userId int64) ([]string, error) {
+	var (
+		codes  = make([]string, recoveryCodeCount)
+		hashes = make([]string, recoveryCodeCount)
+	)
+
+	for i := range codes {
+		digits, err := s.random.Digits(recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = formatRecoveryCode(digits)
+		hashes[i] = s.hashRecoveryCode(userId, digits)
+	}
+
+	err := s.Repository.ReplaceRecoveryCodes(ctx, userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode marks the recovery code as used, recording its use in the
+// audit log.
+func (s *Server) useRecoveryCode(ctx echo.Context, userId int64, code string) (bool, error) {
+	var (
+		rctx   = ctx.Request().Context()
+		digits = normalizeRecoveryCode(code)
+	)
+
+	used, err := s.Repository.UseRecoveryCode(rctx, userId, s.hashRecoveryCode(userId, digits))
+	if err != nil || !used {
+		return false, err
+	}
+
+	return true, s.audit(ctx, userId, userId, auditActionRecoveryCodeUsed)
+}
+
+// formatRecoveryCode splits the digits of a recovery code into groups.
+func formatRecoveryCode(digits string) string {
+	var groups []string
+	for len(digits) > recoveryCodeGroupLength {
+		groups = append(groups, digits[:recoveryCodeGroupLength])
+		digits = digits[recoveryCodeGroupLength:]
+	}
+
+	return strings.Join(append(groups, digits), "-")
+}
+
+// normalizeRecoveryCode removes the separators a recovery code is shown or
+// typed with.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// hashRecoveryCode keys the hash with codeHashKey, so leaked hashes can not be
+// reversed by trying every twelve digit code.
+func (s *Server) hashRecoveryCode(userId int64, code string) string {
+	return util.HashCode(s.codeHashKey, strconv.FormatInt(userId, 10)+":"+code)
+}
+
+func (s *Server) ChangeUsersPassword(ctx echo.Context, _ generated.ChangeUsersPasswordParams) error {
+	var (
+		req         = generated.ChangePasswordRequest{}
+		rctx        = ctx.Request().Context()
+		userId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	claims, err := util.GetClaimsFromContext(rctx)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserById(rctx, userId)
+	if err != nil {
+		return err
+	}
+
+	err = s.verifyCurrentPassword(ctx, user, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validatePassword("new_password", req.NewPassword, user.PhoneNumber, user.FullName); err != nil {
+		return err
+	}
+
+	err = s.setPassword(rctx, user.Id, req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// keep the session that changed the password, every other session might
+	// belong to whoever knew the old one
+	err = s.revokeOtherSessions(rctx, user.Id, claims.SessionId)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// verifyCurrentPassword confirms the user who holds the access token knows
+// the password. Wrong guesses count toward the lockout like failed logins,
+// so a stolen access token cannot be used to guess the password.
+func (s *Server) verifyCurrentPassword(ctx echo.Context, user repository.User, password string) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return accountLockedError(ctx, *user.LockedUntil)
+	}
+
+	match, _, err := s.passwordHasher.Verify(password, user.Password, user.Salt)
+	if err != nil {
+		return err
+	}
+	if !match {
+		lockedUntil, err := s.Repository.IncrementFailedLogin(ctx.Request().Context(), user.Id)
+		if err != nil {
+			return err
+		}
+		if lockedUntil != nil {
+			return accountLockedError(ctx, *lockedUntil)
+		}
+		return echo.NewHTTPError(http.StatusForbidden, "current password is incorrect")
+	}
+
+	return nil
+}
+
+// revokeOtherSessions revokes every session of the user except the current
+// one, together with the access tokens issued for them.
+func (s *Server) revokeOtherSessions(ctx context.Context, userId int64, currentId string) error {
+	revokedIds, err := s.Repository.RevokeOtherSessions(ctx, userId, currentId)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, revokedIds...)
+}
+
+// revokeSessionTokens revokes the access tokens issued for the sessions.
+// They expire within their ttl, after that the entries are no longer needed.
+func (s *Server) revokeSessionTokens(ctx context.Context, sessionIds ...string) error {
+	expiresAt := time.Now().Add(s.jwt.AccessTokenTTL() + time.Minute)
+	for _, id := range sessionIds {
+		err := s.revocation.RevokeToken(ctx, id, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	passwordResetCodeLength      = 6
+	passwordResetCodeTTL         = 10 * time.Minute
+	passwordResetResendCooldown  = time.Minute
+	passwordResetMaxAttempts     = 5
+	passwordResetSendTimeout     = 30 * time.Second
+	passwordResetRequestAccepted = "if the phone number is registered, a reset code has been sent to it"
+)
+
+func (s *Server) RequestUsersPasswordReset(ctx echo.Context) error {
+	var (
+		req = generated.PasswordResetRequestRequest{}
+		res = generated.MessageResponse{Message: passwordResetRequestAccepted}
+	)
+
+	err := ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	// the response is the same whether the phone number is registered or
+	// not and is sent before the code is, so neither its content nor its
+	// timing tells which numbers are registered
+	logger := ctx.Logger()
+	s.runInBackground(func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+		defer cancel()
+
+		err := s.sendPasswordResetCode(sendCtx, req.PhoneNumber)
+		if err != nil {
+			logger.Errorf("failed to send password reset code: %v", err)
+		}
+	})
+
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// sendPasswordResetCode sends a reset code to the user with the phone number,
+// if any. A code that was just sent is not sent again.
+func (s *Server) sendPasswordResetCode(ctx context.Context, phoneNumber string) error {
+	user, err := s.Repository.FindUserByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 || user.DeactivatedAt != nil {
+		return nil
+	}
+
+	active, err := s.Repository.FindActivePasswordResetCode(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if active.Id != 0 && time.Since(active.CreatedAt) < passwordResetResendCooldown {
+		return nil
+	}
+
+	code, err := s.random.Digits(passwordResetCodeLength)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.CreatePasswordResetCode(ctx, repository.CreatePasswordResetCodeInput{
+		UserId:    user.Id,
+		CodeHash:  s.hashPasswordResetCode(user.Id, code),
+		ExpiresAt: time.Now().Add(passwordResetCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your SawitPro password reset code is %s. It expires in %d minutes.",
+		code, int(passwordResetCodeTTL.Minutes()))
+	err = s.smsSender.SendSMS(ctx, user.PhoneNumber, message)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", user.Id, err)
+	}
+
+	return nil
+}
+
+func (s *Server) ResetUsersPassword(ctx echo.Context) error {
+	var (
+		req        = generated.PasswordResetRequest{}
+		rctx       = ctx.Request().Context()
+		invalidErr = echo.NewHTTPError(http.StatusBadRequest, "invalid or expired reset code")
+	)
+
+	err := ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserByPhoneNumber(rctx, req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 || user.DeactivatedAt != nil {
+		return invalidErr
+	}
+
+	code, err := s.Repository.FindActivePasswordResetCode(rctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if code.Id == 0 || code.Attempts >= passwordResetMaxAttempts {
+		return invalidErr
+	}
+
+	attempts, err := s.Repository.IncrementPasswordResetAttempts(rctx, code.Id)
+	if err != nil {
+		return err
+	}
+	if attempts > passwordResetMaxAttempts ||
+		subtle.ConstantTimeCompare([]byte(s.hashPasswordResetCode(user.Id, req.Code)), []byte(code.CodeHash)) != 1 {
+		return invalidErr
+	}
+
+	// only validated once the code is verified, so the policy errors that
+	// depend on the user do not reveal whether the phone number is registered
+	if err := s.validatePassword("new_password", req.NewPassword, user.PhoneNumber, user.FullName); err != nil {
+		return err
+	}
+
+	consumed, err := s.Repository.ConsumePasswordResetCode(rctx, code.Id)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return invalidErr
+	}
+
+	err = s.setPassword(rctx, user.Id, req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeUserTokens(rctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) hashPasswordResetCode(userId int64, code string) string {
+	return util.HashCode(s.codeHashKey, strconv.FormatInt(userId, 10)+":"+code)
+}
+
+func (s *Server) CreateUsersProfile(ctx echo.Context) error {
+	var (
+		req  = generated.RegisterProfileRequest{}
+		res  = generated.RegisterProfileResponse{}
+		rctx = ctx.Request().Context()
+	)
+
+	err := ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validatePassword("password", req.Password, req.PhoneNumber, req.FullName); err != nil {
+		return err
+	}
+
+	createReq := repository.CreateUserInput{
+		FullName:    req.FullName,
+		PhoneNumber: req.PhoneNumber,
+	}
+	createReq.Password, err = s.passwordHasher.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	output, err := s.Repository.CreateUser(rctx, createReq)
+	if err != nil {
+		return err
+	}
+
+	// the user is already created, so a failure to send the code must not
+	// fail the registration
+	if req.VerifyPhone != nil && *req.VerifyPhone {
+		err = s.sendPhoneVerification(rctx, output.Id, req.PhoneNumber)
+		if err != nil {
+			ctx.Logger().Errorf("failed to send phone verification to user %d: %v", output.Id, err)
+		}
+	}
+
+	res.Id = output.Id
+	return ctx.JSON(http.StatusOK, res)
+}
+
+const (
+	listUsersDefaultLimit = 50
+	listUsersMaxLimit     = 100
+)
+
+// The admin endpoints below require the permissions listed for them in
+// api.yml, which are checked by the Authorize middleware. Every change is
+// recorded in the audit log with the admin as the actor, in the same
+// transaction as the change itself.
+
+func (s *Server) ListUsers(ctx echo.Context, params generated.ListUsersParams) error {
+	input := repository.ListUsersInput{
+		SortBy:      repository.UserSortId,
+		CreatedFrom: params.CreatedFrom,
+		CreatedTo:   params.CreatedTo,
+		Limit:       listUsersDefaultLimit,
+	}
+
+	if params.Name != nil {
+		input.Name = *params.Name
+	}
+	if params.PhoneNumber != nil {
+		// phone numbers are stored in E.164, the prefix may be entered as
+		// a local number or with a "+" that was decoded to a space
+		prefix, err := s.phoneParser.NormalizePrefix(*params.PhoneNumber)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid phone_number")
+		}
+		input.PhoneNumber = prefix
+	}
+	if params.Status != nil {
+		if !util.In(*params.Status, generated.Active, generated.Locked, generated.Deactivated) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+		}
+		input.Status = string(*params.Status)
+	}
+	if input.CreatedFrom != nil && input.CreatedTo != nil && !input.CreatedTo.After(*input.CreatedFrom) {
+		return echo.NewHTTPError(http.StatusBadRequest, "created_to must be after created_from")
+	}
+	if params.Sort != nil {
+		if !util.In(*params.Sort, generated.Id, generated.CreatedAt, generated.Name, generated.PhoneNumber) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid sort")
+		}
+		input.SortBy = string(*params.Sort)
+	}
+	if params.Order != nil {
+		if !util.In(*params.Order, generated.Asc, generated.Desc) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid order")
+		}
+		input.Descending = *params.Order == generated.Desc
+	}
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > listUsersMaxLimit {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", listUsersMaxLimit))
+		}
+		input.Limit = *params.Limit
+	}
+	if params.Cursor != nil {
+		after, err := decodeUserCursor(*params.Cursor, input.SortBy, input.Descending)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+		input.After = &after
+	}
+
+	// one more user than asked for tells whether there is a next page
+	limit := input.Limit
+	input.Limit++
+
+	users, err := s.Repository.ListUsers(ctx.Request().Context(), input)
+	if err != nil {
+		return err
+	}
+
+	res := generated.AdminUserListResponse{Users: make([]generated.AdminUser, 0, len(users))}
+	if len(users) > limit {
+		users = users[:limit]
+		cursor := encodeUserCursor(users[limit-1].Key(input.SortBy), input.SortBy, input.Descending)
+		res.NextCursor = &cursor
+	}
+	for _, user := range users {
+		res.Users = append(res.Users, adminUser(user))
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// userCursor is the position of the last user of a page in the list of
+// users. It is only valid for a list in the same order.
+type userCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Id         int64  `json:"i"`
+	Value      string `json:"v,omitempty"`
+}
+
+func encodeUserCursor(key repository.UserKey, sortBy string, descending bool) string {
+	buff, _ := json.Marshal(userCursor{SortBy: sortBy, Descending: descending, Id: key.Id, Value: key.Value})
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+func decodeUserCursor(cursor, sortBy string, descending bool) (repository.UserKey, error) {
+	buff, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return repository.UserKey{}, err
+	}
+
+	var decoded userCursor
+	err = json.Unmarshal(buff, &decoded)
+	if err != nil {
+		return repository.UserKey{}, err
+	}
+	if decoded.SortBy != sortBy || decoded.Descending != descending {
+		return repository.UserKey{}, errors.New("cursor of a list in another order")
+	}
+	// the value is compared as a timestamp by the database
+	if sortBy == repository.UserSortCreatedAt {
+		if _, err := time.Parse(time.RFC3339Nano, decoded.Value); err != nil {
+			return repository.UserKey{}, err
+		}
+	}
+
+	return repository.UserKey{Id: decoded.Id, Value: decoded.Value}, nil
+}
+
+func (s *Server) GetUser(ctx echo.Context, id int64, _ generated.GetUserParams) error {
+	rctx := ctx.Request().Context()
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	roles, err := s.Repository.FindUserRoles(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	res := adminUser(user)
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	res.Roles = &names
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+func (s *Server) CreateUser(ctx echo.Context, _ generated.CreateUserParams) error {
+	var (
+		req          = generated.AdminCreateUserRequest{}
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	req.PhoneNumber, err = s.normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validatePassword("password", req.Password, req.PhoneNumber, req.FullName); err != nil {
+		return err
+	}
+
+	createReq := repository.CreateUserAccountInput{
+		CreateUserInput: repository.CreateUserInput{
+			FullName:    req.FullName,
+			PhoneNumber: req.PhoneNumber,
+		},
+		PhoneVerified: req.PhoneVerified != nil && *req.PhoneVerified,
+	}
+	createReq.Password, err = s.passwordHasher.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	// the id of the user is added to the entry once it is created
+	output, err := s.Repository.CreateUserAccount(rctx, createReq, auditLog(ctx, adminId, 0, auditActionUserCreated, map[string]any{
+		"full_name":      createReq.FullName,
+		"phone_number":   createReq.PhoneNumber,
+		"phone_verified": createReq.PhoneVerified,
+	}))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserById(rctx, output.Id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, adminUser(user))
+}
+
+func (s *Server) UpdateUser(ctx echo.Context, id int64, _ generated.UpdateUserParams) error {
+	var (
+		req          = generated.AdminUpdateUserRequest{}
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	if req.PhoneNumber != nil {
+		*req.PhoneNumber, err = s.normalizePhoneNumber(*req.PhoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	if req.PhoneNumber != nil && *req.PhoneNumber == user.PhoneNumber {
+		req.PhoneNumber = nil
+	}
+	// the new phone number is not verified unless the admin says so
+	if req.PhoneNumber != nil && req.PhoneVerified == nil {
+		req.PhoneVerified = new(bool)
+	}
+
+	if req.FullName == nil && req.PhoneNumber == nil && req.PhoneVerified == nil {
+		return ctx.JSON(http.StatusOK, adminUser(user))
+	}
+
+	details := map[string]any{}
+	if req.FullName != nil && *req.FullName != user.FullName {
+		details["full_name"] = repository.AuditChange{Old: user.FullName, New: *req.FullName}
+	}
+	if req.PhoneNumber != nil {
+		details["phone_number"] = repository.AuditChange{Old: user.PhoneNumber, New: *req.PhoneNumber}
+	}
+	if req.PhoneVerified != nil && *req.PhoneVerified != (user.PhoneVerifiedAt != nil) {
+		details["phone_verified"] = repository.AuditChange{Old: user.PhoneVerifiedAt != nil, New: *req.PhoneVerified}
+	}
+
+	err = s.Repository.UpdateUserAccount(rctx, id, repository.UpdateUserAccountInput{
+		FullName:      req.FullName,
+		PhoneNumber:   req.PhoneNumber,
+		PhoneVerified: req.PhoneVerified,
+	}, auditLog(ctx, adminId, id, auditActionUserUpdated, details))
+	if err != nil {
+		return err
+	}
+
+	user, err = s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, adminUser(user))
+}
+
+func (s *Server) ResetUserPassword(ctx echo.Context, id int64, _ generated.ResetUserPasswordParams) error {
+	var (
+		req          = generated.AdminPasswordResetRequest{}
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validatePassword("new_password", req.NewPassword, user.PhoneNumber, user.FullName); err != nil {
+		return err
+	}
+
+	hashed, err := s.passwordHasher.Hash(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// the password itself is never recorded
+	err = s.Repository.ResetUserPassword(rctx, id, hashed, auditLog(ctx, adminId, id, auditActionUserPasswordReset, nil))
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeUserTokens(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) LockUser(ctx echo.Context, id int64, _ generated.LockUserParams) error {
+	var (
+		req          = generated.LockUserRequest{}
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Bind(&req)
+	if err != nil {
+		return err
+	}
+
+	if !req.LockedUntil.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "locked_until must be in the future")
+	}
+	if id == adminId {
+		return echo.NewHTTPError(http.StatusBadRequest, "admins can not lock themselves")
+	}
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.LockUser(rctx, id, req.LockedUntil, auditLog(ctx, adminId, id, auditActionUserLocked, map[string]any{
+		"locked_until": repository.AuditChange{Old: user.LockedUntil, New: req.LockedUntil},
+	}))
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeUserTokens(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) UnlockUser(ctx echo.Context, id int64, _ generated.UnlockUserParams) error {
+	var (
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.UnlockUser(rctx, id, auditLog(ctx, adminId, id, auditActionUserUnlocked, map[string]any{
+		"locked_until": repository.AuditChange{Old: user.LockedUntil, New: nil},
+	}))
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) DeactivateUser(ctx echo.Context, id int64, _ generated.DeactivateUserParams) error {
+	var (
+		rctx         = ctx.Request().Context()
+		adminId, err = util.GetUserIDFromContext(rctx)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if id == adminId {
+		return echo.NewHTTPError(http.StatusBadRequest, "admins can not deactivate themselves")
+	}
+
+	user, err := s.Repository.FindUserById(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.DeactivateUser(rctx, id, auditLog(ctx, adminId, id, auditActionUserDeactivated, map[string]any{
+		"status": repository.AuditChange{Old: user.Status(), New: repository.UserStatusDeactivated},
+	}))
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeUserTokens(rctx, id)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// adminUser returns the user as shown to admins, without its roles.
+func adminUser(user repository.User) generated.AdminUser {
+	return generated.AdminUser{
+		Id:            user.Id,
+		FullName:      user.FullName,
+		PhoneNumber:   user.PhoneNumber,
+		PhoneVerified: user.PhoneVerifiedAt != nil,
+		Status:        generated.UserStatus(user.Status()),
+		LockedUntil:   user.LockedUntil,
+		DeactivatedAt: user.DeactivatedAt,
+		CreatedAt:     user.CreatedAt,
+		LoginStats: generated.LoginStats{
+			SuccessfulLoginCount: user.SuccessfulLoginCount,
+			FailedLoginCount:     user.FailedLoginCount,
+			LastLoginAt:          user.LastLoginAt,
+			LastFailedLoginAt:    user.LastFailedLoginAt,
+		},
+	}
+}
+
+// maxDeviceLabelLength is the length of sessions.device_label.
+const maxDeviceLabelLength = 100
+
+// startSession creates a session for the device of the request and issues
+// its first tokens.
+func (s *Server) startSession(ctx echo.Context, userId int64, deviceLabel *string) (res generated.UserLoginResponse, err error) {
+	session := repository.CreateSessionInput{
+		Id:        s.random.UUID(),
+		UserId:    userId,
+		UserAgent: ctx.Request().UserAgent(),
+		IpAddress: ctx.RealIP(),
+	}
+	if deviceLabel != nil {
+		session.DeviceLabel = *deviceLabel
+	}
+
+	err = s.Repository.CreateSession(ctx.Request().Context(), session)
+	if err != nil {
+		return
+	}
+
+	return s.issueTokens(ctx.Request().Context(), userId, session.Id, "", "")
+}
+
+// validateDeviceLabel rejects a device label longer than the sessions table
+// stores, before the login it is sent with has any effect.
+func validateDeviceLabel(deviceLabel *string) error {
+	if deviceLabel == nil || utf8.RuneCountInString(*deviceLabel) <= maxDeviceLabelLength {
+		return nil
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+		Message: "invalid device label",
+		Errors: &[]generated.FieldError{
+			{Field: "device_label", Message: fmt.Sprintf("device_label must be at most %d characters", maxDeviceLabelLength)},
+		},
+	})
+}
+
+// issueTokens creates an access token and a refresh token belonging to the
+// given refresh token family. The access token of a session an OAuth client
+// started is issued to the client and only granted the scope the user
+// granted it, any other access token is granted the permissions of the roles
+// of the user.
+func (s *Server) issueTokens(ctx context.Context, userId int64, familyId, clientId, clientScope string) (res generated.UserLoginResponse, err error) {
+	res.Id = userId
+
+	if clientId != "" {
+		res.AccessToken, err = s.jwt.CreateDelegatedAccessToken(userId, familyId, clientId, strings.Fields(clientScope))
+	} else {
+		var roles, permissions []string
+		roles, permissions, err = s.userPermissions(ctx, userId)
+		if err != nil {
+			return
+		}
+		res.AccessToken, err = s.jwt.CreateAccessToken(userId, familyId, roles, permissions)
+	}
+	if err != nil {
+		return
+	}
+	res.TokenType = "Bearer"
+	res.ExpiresIn = int64(s.jwt.AccessTokenTTL().Seconds())
+
+	res.RefreshToken, err = s.random.Token(32)
+	if err != nil {
+		return
+	}
+
+	err = s.Repository.CreateRefreshToken(ctx, repository.CreateRefreshTokenInput{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: util.HashToken(res.RefreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// userPermissions returns the names of the roles of the user and the
+// permissions they grant.
+func (s *Server) userPermissions(ctx context.Context, userId int64) (roles, permissions []string, err error) {
+	userRoles, err := s.Repository.FindUserRoles(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, role := range userRoles {
+		roles = append(roles, role.Name)
+		for _, permission := range role.Permissions {
+			if !util.In(permission, permissions...) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	return roles, permissions, nil
+}
+
+// revokeUserTokens logs the user out of every session. Every access token
+// of a user carries the id of its session, so revoking the sessions revokes
+// the access tokens issued until now, but not those of a later login.
+func (s *Server) revokeUserTokens(ctx context.Context, userId int64) error {
+	revokedIds, err := s.Repository.RevokeUserRefreshTokens(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, revokedIds...)
+}
+
+// setPassword stores the password hashed in the current format. The separate
+// salt is only needed by legacy hashes, so it is cleared.
+func (s *Server) setPassword(ctx context.Context, userId int64, password string) error {
+	hashed, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.Repository.UpdatePassword(ctx, userId, hashed, "")
+}
+
+// validatePassword checks the password against the password policy and
+// reports every violation as a validation error of the given request field.
+// The phone number is also matched without its calling code.
+func (s *Server) validatePassword(field, password, phoneNumber, fullName string) error {
+	personalInfo := []string{phoneNumber, fullName}
+	if national, err := s.phoneParser.NationalNumber(phoneNumber); err == nil {
+		personalInfo = append(personalInfo, national)
+	}
+
+	violations := s.passwordPolicy.Validate(password, personalInfo...)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fieldErrors := make([]generated.FieldError, 0, len(violations))
+	for _, violation := range violations {
+		fieldErrors = append(fieldErrors, generated.FieldError{Field: field, Message: field + " " + violation})
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+		Message: "password does not meet the password policy",
+		Errors:  &fieldErrors,
+	})
+}
+
+// normalizePhoneNumber converts the phone number to E.164, so that it is
+// stored and looked up in one format however it was entered.
+func (s *Server) normalizePhoneNumber(phoneNumber string) (string, error) {
+	normalized, err := s.phoneParser.Normalize(phoneNumber)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "invalid phone number",
+			Errors: &[]generated.FieldError{
+				{Field: "phone_number", Message: "phone_number " + err.Error()},
+			},
+		})
+	}
+
+	return normalized, nil
+}
+
+func accountLockedError(ctx echo.Context, lockedUntil time.Time) error {
+	retryAfter := int64(math.Ceil(time.Until(lockedUntil).Seconds()))
+	ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+
+	return echo.NewHTTPError(http.StatusLocked, "account is locked due to too many failed login attempts")
+}
+
+// Actions recorded in the audit log.
+const (
+	auditActionRecoveryCodeUsed         = "mfa.recovery_code_used"
+	auditActionRecoveryCodesRegenerated = "mfa.recovery_codes_regenerated"
+	auditActionUserCreated              = "admin.user_created"
+	auditActionUserUpdated              = "admin.user_updated"
+	auditActionUserPasswordReset        = "admin.user_password_reset"
+	auditActionUserLocked               = "admin.user_locked"
+	auditActionUserUnlocked             = "admin.user_unlocked"
+	auditActionUserDeactivated          = "admin.user_deactivated"
+)
+
+// audit records an action the actor performed on the user in the audit log.
+func (s *Server) audit(ctx echo.Context, actorId, userId int64, action string) error {
+	return s.Repository.CreateAuditLog(ctx.Request().Context(), auditLog(ctx, actorId, userId, action, nil))
+}
+
+// auditLog returns the audit log entry of an action the actor performed on
+// the user, for the repository to store together with the change.
+func auditLog(ctx echo.Context, actorId, userId int64, action string, details map[string]any) repository.CreateAuditLogInput {
+	return repository.CreateAuditLogInput{
+		ActorId:   actorId,
+		UserId:    userId,
+		Action:    action,
+		IpAddress: ctx.RealIP(),
+		UserAgent: ctx.Request().UserAgent(),
+		Details:   details,
+	}
+}
@@ -4,19 +4,63 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/SawitProRecruitment/UserService/shared/notification"
+	"github.com/SawitProRecruitment/UserService/shared/password"
+	"github.com/SawitProRecruitment/UserService/shared/phone"
+	"github.com/SawitProRecruitment/UserService/shared/revocation"
+	"github.com/SawitProRecruitment/UserService/shared/secretbox"
+	"github.com/SawitProRecruitment/UserService/shared/totp"
 	"github.com/SawitProRecruitment/UserService/shared/util"
+	jwtv4 "github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
+const (
+	testRandomToken = "random-token"
+	testRandomUUID  = "00000000-0000-4000-8000-000000000001"
+)
+
+// fakePasswordHasher hashes a password to "hashed:<password>". A hash of the
+// form "legacy:<password>:<salt>" matches but needs to be rehashed.
+type fakePasswordHasher struct{}
+
+func (fakePasswordHasher) Hash(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (fakePasswordHasher) Verify(password, encoded, legacySalt string) (match, needsRehash bool, err error) {
+	switch encoded {
+	case "hashed:" + password:
+		return true, false, nil
+	case "legacy:" + password + ":" + legacySalt:
+		return true, true, nil
+	}
+	return false, false, nil
+}
+
+func (fakePasswordHasher) DummyHash() string { return "dummy" }
+
+// fakeRandomSource returns the same values on every call.
+type fakeRandomSource struct{}
+
+func (fakeRandomSource) Token(n int) (string, error) { return testRandomToken, nil }
+
+func (fakeRandomSource) Digits(n int) (string, error) { return strings.Repeat("7", n), nil }
+
+func (fakeRandomSource) UUID() string { return testRandomUUID }
+
 func TestServer_UsersLogin(t *testing.T) {
 	var (
 		ctrl   = gomock.NewController(t)
@@ -25,8 +69,11 @@ func TestServer_UsersLogin(t *testing.T) {
 		repo      = repository.NewMockRepositoryInterface(ctrl)
 		jwtSigner = jwt.NewMockSigner(ctrl)
 		s         = &Server{
-			Repository: repo,
-			jwt:        jwtSigner,
+			Repository:     repo,
+			jwt:            jwtSigner,
+			passwordHasher: fakePasswordHasher{},
+			random:         fakeRandomSource{},
+			phoneParser:    phone.DefaultParser(),
 		}
 	)
 	defer ctrl.Finish()
@@ -51,28 +98,50 @@ func TestServer_UsersLogin(t *testing.T) {
 			Id:          1,
 			FullName:    "Sulaiman",
 			PhoneNumber: req.PhoneNumber,
-			Password:    "fddasfa",
+			Password:    "hashed:" + req.Password,
 			Salt:        "fdasfsa",
 		}
 		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
 			Return(user, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).Return(repository.TOTP{}, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(ctx.Request().Context(), user.Id).Return(nil)
+		repo.EXPECT().CreateSession(ctx.Request().Context(), repository.CreateSessionInput{
+			Id:        testRandomUUID,
+			UserId:    user.Id,
+			IpAddress: "192.0.2.1",
+		}).Return(nil)
 
-		jwtSigner.EXPECT().CreateAccessToken(user.Id).Return(expectedRes.AccessToken, nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).
+			Return([]repository.Role{{Name: "admin", Permissions: []string{"users:unlock"}}}, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, testRandomUUID, []string{"admin"}, []string{"users:unlock"}).Return(expectedRes.AccessToken, nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateRefreshTokenInput) error {
+				assert.Equal(t, testRandomUUID, input.FamilyId)
+				assert.Equal(t, util.HashToken(testRandomToken), input.TokenHash)
+				return nil
+			})
 
 		err := s.UsersLogin(ctx)
 		assert.NoError(t, err)
 		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.UserLoginResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.UserLoginResponse{
+			AccessToken:  expectedRes.AccessToken,
+			Id:           1,
+			TokenType:    "Bearer",
+			ExpiresIn:    900,
+			RefreshToken: testRandomToken,
+		}, res)
 	})
 
-	t.Run("Failed CreateAccessToken", func(t *testing.T) {
+	t.Run("Success Rehash Legacy Password", func(t *testing.T) {
 		req := generated.UserLoginRequest{
 			Password:    "fdafafds",
 			PhoneNumber: "+62123132131",
 		}
-		expectedRes := generated.UserLoginResponse{
-			AccessToken: "fdafafdasfasdfafasdf",
-			Id:          1,
-		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
@@ -84,19 +153,26 @@ func TestServer_UsersLogin(t *testing.T) {
 			Id:          1,
 			FullName:    "Sulaiman",
 			PhoneNumber: req.PhoneNumber,
-			Password:    "fddasfa",
+			Password:    "legacy:" + req.Password + ":fdasfsa",
 			Salt:        "fdasfsa",
 		}
 		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
 			Return(user, nil)
-
-		jwtSigner.EXPECT().CreateAccessToken(user.Id).Return(expectedRes.AccessToken, context.DeadlineExceeded)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).Return(repository.TOTP{}, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(ctx.Request().Context(), user.Id).Return(nil)
+		repo.EXPECT().UpdatePassword(ctx.Request().Context(), user.Id, "hashed:"+req.Password, "").Return(nil)
+		repo.EXPECT().CreateSession(ctx.Request().Context(), gomock.Any()).Return(nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, gomock.Any(), nil, nil).Return("fdafafdasfasdfafasdf", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(ctx.Request().Context(), gomock.Any()).Return(nil)
 
 		err := s.UsersLogin(ctx)
-		assert.Error(t, err)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
 	})
 
-	t.Run("Failed FindUserByPhoneNumber", func(t *testing.T) {
+	t.Run("Success MFA Required", func(t *testing.T) {
 		req := generated.UserLoginRequest{
 			Password:    "fdafafds",
 			PhoneNumber: "+62123132131",
@@ -108,297 +184,3249 @@ func TestServer_UsersLogin(t *testing.T) {
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
 		ctx := router.NewContext(r, w)
 
+		confirmedAt := time.Now()
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
 			PhoneNumber: req.PhoneNumber,
-			Password:    "fddasfa",
-			Salt:        "fdasfsa",
+			Password:    "hashed:" + req.Password,
 		}
 		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
-			Return(user, context.DeadlineExceeded)
+			Return(user, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).
+			Return(repository.TOTP{UserId: user.Id, ConfirmedAt: &confirmedAt}, nil)
+		repo.EXPECT().CreateMFAChallenge(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateMFAChallengeInput) error {
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, util.HashToken(testRandomToken), input.TokenHash)
+				return nil
+			})
 
 		err := s.UsersLogin(ctx)
-		assert.Error(t, err)
-	})
-
-	t.Run("Failed Bind", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", nil)
-		ctx := router.NewContext(r, w)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
 
-		err := s.UsersLogin(ctx)
-		assert.Error(t, err)
+		res := generated.MfaChallengeResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.MfaChallengeResponse{
+			MfaRequired: true,
+			MfaToken:    testRandomToken,
+			ExpiresIn:   300,
+		}, res)
 	})
-}
-
-func TestServer_GetUsersProfile(t *testing.T) {
-	var (
-		ctrl   = gomock.NewController(t)
-		router = echo.New()
 
-		repo      = repository.NewMockRepositoryInterface(ctrl)
-		jwtSigner = jwt.NewMockSigner(ctrl)
-		s         = &Server{
-			Repository: repo,
-			jwt:        jwtSigner,
+	t.Run("Failed CreateAccessToken", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
+		}
+		expectedRes := generated.UserLoginResponse{
+			AccessToken: "fdafafdasfasdfafasdf",
+			Id:          1,
 		}
-	)
-	defer ctrl.Finish()
 
-	t.Run("Success", func(t *testing.T) {
+		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
-			PhoneNumber: "+62123132131",
-			Password:    "fddasfa",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "hashed:" + req.Password,
 			Salt:        "fdasfsa",
 		}
-		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
 			Return(user, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).Return(repository.TOTP{}, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(ctx.Request().Context(), user.Id).Return(nil)
+		repo.EXPECT().CreateSession(ctx.Request().Context(), gomock.Any()).Return(nil)
 
-		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
-		assert.NoError(t, err)
-		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, gomock.Any(), nil, nil).Return(expectedRes.AccessToken, context.DeadlineExceeded)
+
+		err := s.UsersLogin(ctx)
+		assert.Error(t, err)
 	})
 
-	t.Run("Failed FindUserById", func(t *testing.T) {
+	t.Run("Failed Wrong Password", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "wrongpassword",
+			PhoneNumber: "+62123132131",
+		}
+
+		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
-			PhoneNumber: "+62123132131",
-			Password:    "fddasfa",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "hashed:fdafafds",
 			Salt:        "fdasfsa",
 		}
-		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
-			Return(user, context.DeadlineExceeded)
-
-		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
-		assert.Error(t, err)
-	})
-
-	t.Run("Failed Invalid UserID", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
-		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", "1"))
-		ctx := router.NewContext(r, w)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(ctx.Request().Context(), user.Id).Return(nil, nil)
 
-		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
-		assert.Error(t, err)
+		err := s.UsersLogin(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid phone number or password"), err)
 	})
-}
-
-func TestServer_UpdateUsersProfile(t *testing.T) {
-	var (
-		ctrl   = gomock.NewController(t)
-		router = echo.New()
-
-		repo      = repository.NewMockRepositoryInterface(ctrl)
-		jwtSigner = jwt.NewMockSigner(ctrl)
-		s         = &Server{
-			Repository: repo,
-			jwt:        jwtSigner,
-		}
-	)
-	defer ctrl.Finish()
 
-	t.Run("Success", func(t *testing.T) {
-		phoneNumber := "+6232131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Failed Wrong Password Locks Account", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "wrongpassword",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
-			PhoneNumber: phoneNumber,
-			Password:    "fddasfa",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "hashed:fdafafds",
 			Salt:        "fdasfsa",
 		}
-		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), *req.PhoneNumber).Return(user, nil)
-		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
-		repo.EXPECT().UpdateUser(ctx.Request().Context(), req.FullName, req.PhoneNumber, user.Id).Return(nil)
+		lockedUntil := time.Now().Add(15 * time.Minute)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(ctx.Request().Context(), user.Id).Return(&lockedUntil, nil)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.NoError(t, err)
-		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+		err := s.UsersLogin(ctx)
+		httpErr, ok := err.(*echo.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusLocked, httpErr.Code)
+		assert.Equal(t, "900", ctx.Response().Header().Get(echo.HeaderRetryAfter))
 	})
 
-	t.Run("Failed UpdateUser", func(t *testing.T) {
-		phoneNumber := "+6232131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Failed Account Locked", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
+		lockedUntil := time.Now().Add(time.Hour)
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
-			PhoneNumber: phoneNumber,
-			Password:    "fddasfa",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "hashed:" + req.Password,
 			Salt:        "fdasfsa",
+			LockedUntil: &lockedUntil,
 		}
-		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), *req.PhoneNumber).Return(user, nil)
-		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
-		repo.EXPECT().UpdateUser(ctx.Request().Context(), req.FullName, req.PhoneNumber, user.Id).Return(context.DeadlineExceeded)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, nil)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.Error(t, err)
+		err := s.UsersLogin(ctx)
+		httpErr, ok := err.(*echo.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusLocked, httpErr.Code)
+		assert.Equal(t, "3600", ctx.Response().Header().Get(echo.HeaderRetryAfter))
 	})
 
-	t.Run("Failed FindUserById", func(t *testing.T) {
-		phoneNumber := "+6232131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Success Lock Expired", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
+		lockedUntil := time.Now().Add(-time.Minute)
 		user := repository.User{
 			Id:          1,
 			FullName:    "Sulaiman",
-			PhoneNumber: phoneNumber,
-			Password:    "fddasfa",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "hashed:" + req.Password,
 			Salt:        "fdasfsa",
+			LockedUntil: &lockedUntil,
 		}
-		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), *req.PhoneNumber).Return(user, nil)
-		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, context.DeadlineExceeded)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).Return(repository.TOTP{}, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(ctx.Request().Context(), user.Id).Return(nil)
+		repo.EXPECT().CreateSession(ctx.Request().Context(), gomock.Any()).Return(nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, gomock.Any(), nil, nil).Return("fdafafdasfasdfafasdf", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(ctx.Request().Context(), gomock.Any()).Return(nil)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.Error(t, err)
+		err := s.UsersLogin(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
 	})
 
-	t.Run("Failed Conflict PhoneNumber", func(t *testing.T) {
-		phoneNumber := "+6232131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Failed Unknown PhoneNumber", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
-		user := repository.User{
-			Id:          2,
-			FullName:    "Sulaiman",
-			PhoneNumber: phoneNumber,
-			Password:    "fddasfa",
-			Salt:        "fdasfsa",
-		}
-		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), *req.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(repository.User{}, nil)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.Error(t, err)
+		err := s.UsersLogin(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid phone number or password"), err)
 	})
 
-	t.Run("Failed FindUserByPhoneNumber", func(t *testing.T) {
-		phoneNumber := "+6232131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Failed Deactivated User", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
+		deactivatedAt := time.Now().Add(-time.Hour)
 		user := repository.User{
-			Id:          1,
-			FullName:    "Sulaiman",
-			PhoneNumber: phoneNumber,
-			Password:    "fddasfa",
-			Salt:        "fdasfsa",
+			Id:            1,
+			FullName:      "Sulaiman",
+			PhoneNumber:   req.PhoneNumber,
+			Password:      "hashed:fdafafds",
+			DeactivatedAt: &deactivatedAt,
 		}
-		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), *req.PhoneNumber).Return(user, context.DeadlineExceeded)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, nil)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.Error(t, err)
+		err := s.UsersLogin(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid phone number or password"), err)
 	})
 
-	t.Run("Failed Prefix PhoneNumber", func(t *testing.T) {
-		phoneNumber := "+12123132131"
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: &phoneNumber,
+	t.Run("Failed FindUserByPhoneNumber", func(t *testing.T) {
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
 		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		user := repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: req.PhoneNumber,
+			Password:    "fddasfa",
+			Salt:        "fdasfsa",
+		}
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), req.PhoneNumber).
+			Return(user, context.DeadlineExceeded)
+
+		err := s.UsersLogin(ctx)
 		assert.Error(t, err)
 	})
 
-	t.Run("Failed NoContent", func(t *testing.T) {
-		req := generated.UpdateProfileRequest{}
+	t.Run("Failed Device Label Too Long", func(t *testing.T) {
+		deviceLabel := strings.Repeat("ä", maxDeviceLabelLength+1)
+		req := generated.UserLoginRequest{
+			Password:    "fdafafds",
+			PhoneNumber: "+62123132131",
+			DeviceLabel: &deviceLabel,
+		}
 
 		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", bytes.NewBuffer(buff))
 		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
-		assert.NoError(t, err)
-		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+		err := s.UsersLogin(ctx)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
 	})
 
 	t.Run("Failed Bind", func(t *testing.T) {
-		req := generated.UpdateProfileRequest{
-			PhoneNumber: nil,
-		}
-
-		buff, _ := json.Marshal(req)
 		w := httptest.NewRecorder()
-		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
-		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", nil)
 		ctx := router.NewContext(r, w)
 
-		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		err := s.UsersLogin(ctx)
 		assert.Error(t, err)
 	})
 }
 
+func TestServer_RequestUsersLoginOtp(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		smsSender = notification.NewMockSMSSender(ctrl)
+		s         = &Server{
+			Repository:  repo,
+			smsSender:   smsSender,
+			phoneParser: phone.DefaultParser(),
+			random:      fakeRandomSource{},
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+
+		// the code is sent after the response, once the test runs the work
+		pending []func()
+	)
+	defer ctrl.Finish()
+
+	s.background = func(work func()) { pending = append(pending, work) }
+	runPending := func() {
+		for _, work := range pending {
+			work()
+		}
+		pending = nil
+	}
+
+	newContext := func(phoneNumber string) echo.Context {
+		buff, _ := json.Marshal(generated.LoginOtpRequest{PhoneNumber: phoneNumber})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login/otp/request", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext("0123-132-131")
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().CountLoginOTPsSince(gomock.Any(), user.PhoneNumber, gomock.Any()).Return(1, nil)
+		repo.EXPECT().FindActiveLoginOTP(gomock.Any(), user.PhoneNumber).Return(repository.LoginOTP{}, nil)
+		repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateLoginOTPInput) error {
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, user.PhoneNumber, input.PhoneNumber)
+				assert.Equal(t, s.hashLoginOTP(user.Id, user.PhoneNumber, "777777"), input.CodeHash)
+				return nil
+			})
+		smsSender.EXPECT().SendSMS(gomock.Any(), user.PhoneNumber,
+			"Your SawitPro login code is 777777. It expires in 5 minutes.").Return(nil)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Unknown PhoneNumber", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(repository.User{}, nil)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Account Locked", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		locked := user
+		lockedUntil := time.Now().Add(time.Minute)
+		locked.LockedUntil = &lockedUntil
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(locked, nil)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Rate Limited", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().CountLoginOTPsSince(gomock.Any(), user.PhoneNumber, gomock.Any()).
+			Return(loginOTPRateLimit, nil)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Within Resend Cooldown", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().CountLoginOTPsSince(gomock.Any(), user.PhoneNumber, gomock.Any()).Return(1, nil)
+		repo.EXPECT().FindActiveLoginOTP(gomock.Any(), user.PhoneNumber).
+			Return(repository.LoginOTP{Id: 1, UserId: user.Id, CreatedAt: time.Now()}, nil)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success CreateLoginOTP Failure Only Logged", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().CountLoginOTPsSince(gomock.Any(), user.PhoneNumber, gomock.Any()).Return(0, nil)
+		repo.EXPECT().FindActiveLoginOTP(gomock.Any(), user.PhoneNumber).Return(repository.LoginOTP{}, nil)
+		repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(context.DeadlineExceeded)
+
+		err := s.RequestUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+}
+
+func TestServer_VerifyUsersLoginOtp(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository:  repo,
+			jwt:         jwtSigner,
+			phoneParser: phone.DefaultParser(),
+			random:      fakeRandomSource{},
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+		otp  = repository.LoginOTP{
+			Id:          5,
+			UserId:      user.Id,
+			PhoneNumber: user.PhoneNumber,
+			CodeHash:    s.hashLoginOTP(user.Id, user.PhoneNumber, "123456"),
+			ExpiresAt:   time.Now().Add(time.Minute),
+		}
+		invalidErr = echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired login code")
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) (echo.Context, *httptest.ResponseRecorder) {
+		buff, _ := json.Marshal(generated.LoginOtpVerifyRequest{PhoneNumber: user.PhoneNumber, Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login/otp/verify", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(otp, nil)
+		repo.EXPECT().IncrementLoginOTPAttempts(ctx.Request().Context(), otp.Id).Return(1, nil)
+		repo.EXPECT().ConsumeLoginOTP(ctx.Request().Context(), otp.Id).Return(true, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).Return(repository.TOTP{}, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(ctx.Request().Context(), user.Id).Return(nil)
+		repo.EXPECT().CreateSession(ctx.Request().Context(), repository.CreateSessionInput{
+			Id:        testRandomUUID,
+			UserId:    user.Id,
+			IpAddress: "192.0.2.1",
+		}).Return(nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, testRandomUUID, nil, nil).Return("fdafafdasfasdfafasdf", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(ctx.Request().Context(), gomock.Any()).Return(nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.UserLoginResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.UserLoginResponse{
+			AccessToken:  "fdafafdasfasdfafasdf",
+			Id:           1,
+			TokenType:    "Bearer",
+			ExpiresIn:    900,
+			RefreshToken: testRandomToken,
+		}, res)
+	})
+
+	t.Run("Success MFA Required", func(t *testing.T) {
+		ctx, w := newContext("123456")
+
+		confirmedAt := time.Now()
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(otp, nil)
+		repo.EXPECT().IncrementLoginOTPAttempts(ctx.Request().Context(), otp.Id).Return(1, nil)
+		repo.EXPECT().ConsumeLoginOTP(ctx.Request().Context(), otp.Id).Return(true, nil)
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), user.Id).
+			Return(repository.TOTP{UserId: user.Id, ConfirmedAt: &confirmedAt}, nil)
+		repo.EXPECT().CreateMFAChallenge(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateMFAChallengeInput) error {
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, util.HashToken(testRandomToken), input.TokenHash)
+				return nil
+			})
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+
+		res := generated.MfaChallengeResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.True(t, res.MfaRequired)
+		assert.Equal(t, testRandomToken, res.MfaToken)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx, _ := newContext("654321")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(otp, nil)
+		repo.EXPECT().IncrementLoginOTPAttempts(ctx.Request().Context(), otp.Id).Return(1, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Too Many Attempts", func(t *testing.T) {
+		ctx, _ := newContext("123456")
+
+		exhausted := otp
+		exhausted.Attempts = loginOTPMaxAttempts
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(exhausted, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Code Of Previous Owner", func(t *testing.T) {
+		ctx, _ := newContext("123456")
+
+		previous := otp
+		previous.UserId = 2
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(previous, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Already Consumed", func(t *testing.T) {
+		ctx, _ := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActiveLoginOTP(ctx.Request().Context(), user.PhoneNumber).Return(otp, nil)
+		repo.EXPECT().IncrementLoginOTPAttempts(ctx.Request().Context(), otp.Id).Return(1, nil)
+		repo.EXPECT().ConsumeLoginOTP(ctx.Request().Context(), otp.Id).Return(false, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Unknown PhoneNumber", func(t *testing.T) {
+		ctx, _ := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(repository.User{}, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Account Locked", func(t *testing.T) {
+		ctx, _ := newContext("123456")
+
+		locked := user
+		lockedUntil := time.Now().Add(time.Minute)
+		locked.LockedUntil = &lockedUntil
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(locked, nil)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, http.StatusLocked, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "60", ctx.Response().Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("Failed Device Label Too Long", func(t *testing.T) {
+		deviceLabel := strings.Repeat("a", maxDeviceLabelLength+1)
+		buff, _ := json.Marshal(generated.LoginOtpVerifyRequest{PhoneNumber: user.PhoneNumber, Code: "123456", DeviceLabel: &deviceLabel})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login/otp/verify", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		ctx := router.NewContext(r, w)
+
+		err := s.VerifyUsersLoginOtp(ctx)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
+
+// newTestTOTP returns a confirmed authenticator of the user, with its secret
+// sealed by the box, and the code it currently shows.
+func newTestTOTP(t *testing.T, box *secretbox.Box, userId int64) (repository.TOTP, string) {
+	secret, err := totp.GenerateSecret()
+	assert.NoError(t, err)
+
+	sealed, err := box.Seal([]byte(secret))
+	assert.NoError(t, err)
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	assert.NoError(t, err)
+
+	confirmedAt := time.Now()
+	return repository.TOTP{UserId: userId, Secret: sealed, ConfirmedAt: &confirmedAt}, code
+}
+
+// wrongTOTPCode returns a code other than the given one.
+func wrongTOTPCode(code string) string {
+	wrong := []byte(code)
+	wrong[0] = '0' + (wrong[0]-'0'+5)%10
+	return string(wrong)
+}
+
+func newTestMFABox(t *testing.T) *secretbox.Box {
+	box, err := secretbox.New(bytes.Repeat([]byte{1}, secretbox.KeyLength))
+	assert.NoError(t, err)
+	return box
+}
+
+func TestServer_VerifyUsersLoginMfa(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		box       = newTestMFABox(t)
+		s         = &Server{
+			Repository:  repo,
+			jwt:         jwtSigner,
+			random:      fakeRandomSource{},
+			mfaSecrets:  box,
+			codeHashKey: []byte("code-hash-key"),
+		}
+		user      = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+		challenge = repository.MFAChallenge{
+			Id:          9,
+			UserId:      user.Id,
+			TokenHash:   util.HashToken("mfa-token"),
+			DeviceLabel: "Pixel 8",
+			ExpiresAt:   time.Now().Add(time.Minute),
+		}
+		authenticator, code = newTestTOTP(t, box, user.Id)
+		invalidErr          = echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired mfa token")
+	)
+	defer ctrl.Finish()
+
+	newContext := func(token, code string) (echo.Context, *httptest.ResponseRecorder) {
+		buff, _ := json.Marshal(generated.MfaLoginRequest{MfaToken: token, Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login/mfa", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext("mfa-token", code)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(1, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(rctx, user.Id, gomock.Any()).Return(true, nil)
+		repo.EXPECT().ConsumeMFAChallenge(rctx, challenge.Id).Return(true, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(rctx, user.Id).Return(nil)
+		repo.EXPECT().CreateSession(rctx, repository.CreateSessionInput{
+			Id:          testRandomUUID,
+			UserId:      user.Id,
+			DeviceLabel: challenge.DeviceLabel,
+			IpAddress:   "192.0.2.1",
+		}).Return(nil)
+		repo.EXPECT().FindUserRoles(rctx, user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, testRandomUUID, nil, nil).Return("access-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(rctx, gomock.Any()).Return(nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.UserLoginResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "access-token", res.AccessToken)
+		assert.Equal(t, testRandomToken, res.RefreshToken)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", wrongTOTPCode(code))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(1, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().IncrementFailedLogin(rctx, user.Id).Return(nil, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Code Already Used", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", code)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(2, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(rctx, user.Id, gomock.Any()).Return(false, nil)
+		repo.EXPECT().IncrementFailedLogin(rctx, user.Id).Return(nil, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Locked", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", code)
+		rctx := ctx.Request().Context()
+
+		lockedUntil := time.Now().Add(15 * time.Minute)
+		used := authenticator
+		used.LastUsedStep = totp.Step(time.Now()) + 1
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(3, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(used, nil)
+		repo.EXPECT().IncrementFailedLogin(rctx, user.Id).Return(&lockedUntil, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, http.StatusLocked, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Success Recovery Code", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", "1234-5678-9012")
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(1, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().UseRecoveryCode(rctx, user.Id, s.hashRecoveryCode(user.Id, "123456789012")).Return(true, nil)
+		repo.EXPECT().CreateAuditLog(rctx, repository.CreateAuditLogInput{
+			ActorId:   user.Id,
+			UserId:    user.Id,
+			Action:    auditActionRecoveryCodeUsed,
+			IpAddress: "192.0.2.1",
+		}).Return(nil)
+		repo.EXPECT().ConsumeMFAChallenge(rctx, challenge.Id).Return(true, nil)
+		repo.EXPECT().IncrementSuccessfulLogin(rctx, user.Id).Return(nil)
+		repo.EXPECT().CreateSession(rctx, gomock.Any()).Return(nil)
+		repo.EXPECT().FindUserRoles(rctx, user.Id).Return(nil, nil)
+		jwtSigner.EXPECT().CreateAccessToken(user.Id, testRandomUUID, nil, nil).Return("access-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(rctx, gomock.Any()).Return(nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Failed Recovery Code Already Used", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", "1234-5678-9012")
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(1, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().UseRecoveryCode(rctx, user.Id, s.hashRecoveryCode(user.Id, "123456789012")).Return(false, nil)
+		repo.EXPECT().IncrementFailedLogin(rctx, user.Id).Return(nil, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Deactivated User", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", code)
+		rctx := ctx.Request().Context()
+
+		deactivatedAt := time.Now()
+		deactivated := user
+		deactivated.DeactivatedAt = &deactivatedAt
+		repo.EXPECT().FindActiveMFAChallenge(rctx, challenge.TokenHash).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(deactivated, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Invalid Token", func(t *testing.T) {
+		ctx, _ := newContext("unknown", code)
+
+		repo.EXPECT().FindActiveMFAChallenge(ctx.Request().Context(), util.HashToken("unknown")).
+			Return(repository.MFAChallenge{}, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Too Many Attempts", func(t *testing.T) {
+		ctx, _ := newContext("mfa-token", code)
+
+		exhausted := challenge
+		exhausted.Attempts = mfaChallengeMaxAttempts
+		repo.EXPECT().FindActiveMFAChallenge(ctx.Request().Context(), challenge.TokenHash).Return(exhausted, nil)
+
+		err := s.VerifyUsersLoginMfa(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+}
+
+func TestServer_GetJwks(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{jwt: jwtSigner}
+	)
+	defer ctrl.Finish()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	ctx := router.NewContext(r, w)
+
+	jwtSigner.EXPECT().PublicKeys().Return([]jwt.JSONWebKey{
+		{KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: "current", N: "modulus", E: "AQAB"},
+		{KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: "previous", N: "modulus", E: "AQAB"},
+	})
+
+	err := s.GetJwks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, ctx.Response().Status)
+	assert.Equal(t, "public, max-age=300", w.Header().Get(echo.HeaderCacheControl))
+
+	res := generated.JwksResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(t, res.Keys, 2)
+	assert.Equal(t, "current", res.Keys[0].Kid)
+	assert.Equal(t, "AQAB", *res.Keys[0].E)
+}
+
+func TestServer_CreateOauthToken(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+		}
+		client = repository.OAuthClient{
+			ClientId:   "billing",
+			SecretHash: util.HashToken("billing-secret"),
+			Scopes:     []string{"introspect", "users:read"},
+		}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		r.SetBasicAuth("billing", "billing-secret")
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"grant_type": {"client_credentials"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		jwtSigner.EXPECT().CreateClientToken("billing", client.Scopes).Return("client-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.CreateOauthToken(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+		assert.Equal(t, "no-store", w.Header().Get(echo.HeaderCacheControl))
+
+		res := generated.OAuthTokenResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.OAuthTokenResponse{
+			AccessToken: "client-token",
+			TokenType:   "Bearer",
+			ExpiresIn:   900,
+			Scope:       "introspect users:read",
+		}, res)
+	})
+
+	t.Run("Success Requested Scope", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		jwtSigner.EXPECT().CreateClientToken("billing", []string{"users:read"}).Return("client-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.CreateOauthToken(ctx)
+		assert.NoError(t, err)
+
+		res := generated.OAuthTokenResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "users:read", res.Scope)
+	})
+
+	t.Run("Failed Scope Not Allowed", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:write"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "invalid_scope", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Unsupported Grant", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"grant_type": {"password"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "unsupported_grant_type", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Unknown Client", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"grant_type": {"client_credentials"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(repository.OAuthClient{}, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestServer_CreateOauthToken_AuthorizationCode(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			random:     fakeRandomSource{},
+		}
+		client = repository.OAuthClient{
+			ClientId:     "dashboard",
+			Scopes:       []string{"openid", "profile", "phone"},
+			RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+		code = repository.AuthorizationCode{
+			ClientId:      client.ClientId,
+			UserId:        user.Id,
+			RedirectURI:   "https://dashboard.example.com/callback",
+			Scope:         "openid profile",
+			Nonce:         "nonce",
+			CodeChallenge: "1Vw6T9WgBoZZ7YtJT53wDmWvLc8pdofmeeHq86F2Vxs",
+			CreatedAt:     time.Unix(1700000000, 0),
+		}
+		verifier = "dBjftJeZ4CVP-mJ92K9qQJHQCzm0OcZAfnpyvVwDiDI"
+	)
+	defer ctrl.Finish()
+
+	// the client is a public client, which only sends its client_id
+	newContext := func(form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+		form.Set("client_id", client.ClientId)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		return router.NewContext(r, w), w
+	}
+	codeForm := func(verifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {"authorization-code"},
+			"redirect_uri":  {code.RedirectURI},
+			"code_verifier": {verifier},
+		}
+	}
+
+	t.Run("Success Authorization Code", func(t *testing.T) {
+		ctx, w := newContext(codeForm(verifier))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().ConsumeAuthorizationCode(rctx, util.HashToken("authorization-code")).Return(code, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().CreateSession(rctx, repository.CreateSessionInput{
+			Id:          testRandomUUID,
+			UserId:      user.Id,
+			IpAddress:   "192.0.2.1",
+			DeviceLabel: client.ClientId,
+			ClientId:    client.ClientId,
+			Scope:       code.Scope,
+		}).Return(nil)
+		jwtSigner.EXPECT().CreateDelegatedAccessToken(user.Id, testRandomUUID, client.ClientId, []string{"openid", "profile"}).Return("access-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(rctx, gomock.Any()).Return(nil)
+		jwtSigner.EXPECT().CreateIDToken(user.Id, client.ClientId, jwt.IDTokenClaims{
+			Nonce:    "nonce",
+			AuthTime: 1700000000,
+			Name:     "Sulaiman",
+		}).Return("id-token", nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+		assert.Equal(t, "no-store", w.Header().Get(echo.HeaderCacheControl))
+
+		res := generated.OAuthTokenResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		refreshToken, idToken := testRandomToken, "id-token"
+		assert.Equal(t, generated.OAuthTokenResponse{
+			AccessToken:  "access-token",
+			TokenType:    "Bearer",
+			ExpiresIn:    900,
+			Scope:        "openid profile",
+			RefreshToken: &refreshToken,
+			IdToken:      &idToken,
+		}, res)
+	})
+
+	t.Run("Failed Wrong Code Verifier", func(t *testing.T) {
+		ctx, _ := newContext(codeForm(strings.Repeat("a", 43)))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().ConsumeAuthorizationCode(rctx, util.HashToken("authorization-code")).Return(code, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "invalid_grant", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Code Of Other Client", func(t *testing.T) {
+		ctx, _ := newContext(codeForm(verifier))
+		rctx := ctx.Request().Context()
+
+		other := code
+		other.ClientId = "partner"
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().ConsumeAuthorizationCode(rctx, util.HashToken("authorization-code")).Return(other, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, "invalid_grant", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Deactivated User", func(t *testing.T) {
+		ctx, _ := newContext(codeForm(verifier))
+		rctx := ctx.Request().Context()
+
+		deactivatedAt := time.Now()
+		deactivated := user
+		deactivated.DeactivatedAt = &deactivatedAt
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().ConsumeAuthorizationCode(rctx, util.HashToken("authorization-code")).Return(code, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(deactivated, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, "invalid_grant", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Used Code", func(t *testing.T) {
+		ctx, _ := newContext(codeForm(verifier))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().ConsumeAuthorizationCode(rctx, util.HashToken("authorization-code")).
+			Return(repository.AuthorizationCode{}, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, "invalid_grant", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Success Refresh Token", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-token"}})
+		rctx := ctx.Request().Context()
+
+		token := repository.RefreshToken{Id: 3, UserId: user.Id, FamilyId: "family", ExpiresAt: time.Now().Add(time.Hour)}
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().FindRefreshTokenByHash(rctx, util.HashToken("refresh-token")).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(rctx, token.Id).Return(true, nil)
+		repo.EXPECT().TouchSession(rctx, "family").Return(nil)
+		repo.EXPECT().FindSession(rctx, "family").
+			Return(repository.Session{Id: "family", UserId: user.Id, ClientId: client.ClientId, Scope: "openid"}, nil)
+		jwtSigner.EXPECT().CreateDelegatedAccessToken(user.Id, "family", client.ClientId, []string{"openid"}).Return("access-token", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(rctx, gomock.Any()).Return(nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.NoError(t, err)
+
+		res := generated.OAuthTokenResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "access-token", res.AccessToken)
+		assert.Equal(t, "openid", res.Scope)
+		assert.Equal(t, testRandomToken, *res.RefreshToken)
+		assert.Nil(t, res.IdToken)
+	})
+
+	t.Run("Failed Refresh Token Of Other Session", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-token"}})
+		rctx := ctx.Request().Context()
+
+		// a login to this service itself is no session of the client
+		token := repository.RefreshToken{Id: 3, UserId: user.Id, FamilyId: "family", ExpiresAt: time.Now().Add(time.Hour)}
+		repo.EXPECT().FindOAuthClient(rctx, client.ClientId).Return(client, nil)
+		repo.EXPECT().FindRefreshTokenByHash(rctx, util.HashToken("refresh-token")).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(rctx, token.Id).Return(true, nil)
+		repo.EXPECT().TouchSession(rctx, "family").Return(nil)
+		repo.EXPECT().FindSession(rctx, "family").Return(repository.Session{Id: "family", UserId: user.Id}, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, "invalid_grant", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+	})
+
+	t.Run("Failed Public Client Credentials", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"grant_type": {"client_credentials"}})
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), client.ClientId).Return(client, nil)
+
+		err := s.CreateOauthToken(ctx)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestServer_GetOpenidConfiguration(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{jwt: jwtSigner}
+	)
+	defer ctrl.Finish()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	ctx := router.NewContext(r, w)
+
+	jwtSigner.EXPECT().Issuer().Return("https://users.example.com/")
+	jwtSigner.EXPECT().PublicKeys().Return([]jwt.JSONWebKey{
+		{KeyType: "EC", Algorithm: "ES256", KeyID: "current"},
+		{KeyType: "RSA", Algorithm: "RS256", KeyID: "previous"},
+		{KeyType: "RSA", Algorithm: "RS256", KeyID: "oldest"},
+	})
+
+	err := s.GetOpenidConfiguration(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, ctx.Response().Status)
+
+	res := generated.OpenidConfiguration{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "https://users.example.com/", res.Issuer)
+	assert.Equal(t, "https://users.example.com/v1/oauth/authorize", res.AuthorizationEndpoint)
+	assert.Equal(t, "https://users.example.com/.well-known/jwks.json", res.JwksUri)
+	assert.Equal(t, []string{"ES256", "RS256"}, res.IdTokenSigningAlgValuesSupported)
+	assert.Equal(t, []string{"S256"}, res.CodeChallengeMethodsSupported)
+}
+
+// newTestAuthorizationRequest returns the parameters of a valid authorization
+// request of the dashboard client.
+func newTestAuthorizationRequest() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"dashboard"},
+		"redirect_uri":          {"https://dashboard.example.com/callback"},
+		"scope":                 {"openid profile"},
+		"state":                 {"state"},
+		"nonce":                 {"nonce"},
+		"code_challenge":        {"1Vw6T9WgBoZZ7YtJT53wDmWvLc8pdofmeeHq86F2Vxs"},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+var testDashboardClient = repository.OAuthClient{
+	ClientId:     "dashboard",
+	Scopes:       []string{"openid", "profile", "phone"},
+	RedirectURIs: []string{"https://dashboard.example.com/callback"},
+}
+
+func TestServer_AuthorizeOauth(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{Repository: repo, random: fakeRandomSource{}}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(query url.Values) (echo.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/oauth/authorize?"+query.Encode(), nil)
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext(newTestAuthorizationRequest())
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(testDashboardClient, nil)
+
+		err := s.AuthorizeOauth(ctx, generated.AuthorizeOauthParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+		assert.Equal(t, "DENY", w.Header().Get(echo.HeaderXFrameOptions))
+		assert.Contains(t, w.Body.String(), `<input type="hidden" name="redirect_uri" value="https://dashboard.example.com/callback">`)
+		assert.Contains(t, w.Body.String(), `name="password"`)
+		assert.Contains(t, w.Body.String(), `<input type="hidden" name="csrf_token" value="`+testRandomToken+`">`)
+		assert.Contains(t, w.Header().Get(echo.HeaderSetCookie), authorizeCSRFCookie+"="+testRandomToken)
+	})
+
+	t.Run("Failed Unknown Client", func(t *testing.T) {
+		ctx, w := newContext(newTestAuthorizationRequest())
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(repository.OAuthClient{}, nil)
+
+		err := s.AuthorizeOauth(ctx, generated.AuthorizeOauthParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, ctx.Response().Status)
+		assert.Contains(t, w.Body.String(), "unknown client")
+		assert.NotContains(t, w.Body.String(), "<form")
+	})
+
+	t.Run("Failed Unregistered Redirect URI", func(t *testing.T) {
+		query := newTestAuthorizationRequest()
+		query.Set("redirect_uri", "https://attacker.example.com/callback")
+		ctx, w := newContext(query)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(testDashboardClient, nil)
+
+		err := s.AuthorizeOauth(ctx, generated.AuthorizeOauthParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, ctx.Response().Status)
+		assert.Empty(t, w.Header().Get(echo.HeaderLocation))
+	})
+
+	t.Run("Failed Missing Code Challenge", func(t *testing.T) {
+		query := newTestAuthorizationRequest()
+		query.Del("code_challenge")
+		ctx, w := newContext(query)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(testDashboardClient, nil)
+
+		err := s.AuthorizeOauth(ctx, generated.AuthorizeOauthParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, ctx.Response().Status)
+
+		location, err := url.Parse(w.Header().Get(echo.HeaderLocation))
+		assert.NoError(t, err)
+		assert.Equal(t, "dashboard.example.com", location.Host)
+		assert.Equal(t, "invalid_request", location.Query().Get("error"))
+		assert.Equal(t, "state", location.Query().Get("state"))
+	})
+
+	t.Run("Failed Scope Not Allowed", func(t *testing.T) {
+		query := newTestAuthorizationRequest()
+		query.Set("scope", "openid introspect")
+		ctx, w := newContext(query)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(testDashboardClient, nil)
+
+		err := s.AuthorizeOauth(ctx, generated.AuthorizeOauthParams{})
+		assert.NoError(t, err)
+
+		location, err := url.Parse(w.Header().Get(echo.HeaderLocation))
+		assert.NoError(t, err)
+		assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+	})
+}
+
+func TestServer_SubmitOauthAuthorize(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		box  = newTestMFABox(t)
+		s    = &Server{
+			Repository:     repo,
+			passwordHasher: fakePasswordHasher{},
+			random:         fakeRandomSource{},
+			phoneParser:    phone.DefaultParser(),
+			mfaSecrets:     box,
+		}
+		user = repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: "+62123132131",
+			Password:    "hashed:password",
+		}
+		authenticator, code = newTestTOTP(t, box, user.Id)
+	)
+	defer ctrl.Finish()
+
+	newContext := func(form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+		if _, ok := form[authorizeCSRFField]; !ok {
+			form.Set(authorizeCSRFField, "csrf-token")
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/oauth/authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		r.AddCookie(&http.Cookie{Name: authorizeCSRFCookie, Value: "csrf-token"})
+		return router.NewContext(r, w), w
+	}
+	passwordForm := func(password string) url.Values {
+		form := newTestAuthorizationRequest()
+		form.Set("phone_number", user.PhoneNumber)
+		form.Set("password", password)
+		return form
+	}
+	expectAuthorizationCode := func(rctx context.Context) {
+		repo.EXPECT().IncrementSuccessfulLogin(rctx, user.Id).Return(nil)
+		repo.EXPECT().CreateAuthorizationCode(rctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateAuthorizationCodeInput) error {
+				assert.Equal(t, util.HashToken(testRandomToken), input.CodeHash)
+				assert.Equal(t, "dashboard", input.ClientId)
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, "openid profile", input.Scope)
+				assert.Equal(t, "nonce", input.Nonce)
+				assert.Equal(t, "1Vw6T9WgBoZZ7YtJT53wDmWvLc8pdofmeeHq86F2Vxs", input.CodeChallenge)
+				assert.WithinDuration(t, time.Now().Add(authorizationCodeTTL), input.ExpiresAt, time.Second)
+				return nil
+			})
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext(passwordForm("password"))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, "dashboard").Return(testDashboardClient, nil)
+		repo.EXPECT().FindUserByPhoneNumber(rctx, user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(repository.TOTP{}, nil)
+		expectAuthorizationCode(rctx)
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, ctx.Response().Status)
+		assert.Equal(t, "https://dashboard.example.com/callback?code="+testRandomToken+"&state=state",
+			w.Header().Get(echo.HeaderLocation))
+	})
+
+	t.Run("Failed Wrong Password", func(t *testing.T) {
+		ctx, w := newContext(passwordForm("wrong"))
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, "dashboard").Return(testDashboardClient, nil)
+		repo.EXPECT().FindUserByPhoneNumber(rctx, user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(rctx, user.Id).Return(nil, nil)
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, ctx.Response().Status)
+		assert.Contains(t, w.Body.String(), "invalid phone number or password")
+		assert.Contains(t, w.Body.String(), `value="&#43;62123132131"`)
+	})
+
+	t.Run("Failed CSRF Token Mismatch", func(t *testing.T) {
+		form := passwordForm("password")
+		form.Set(authorizeCSRFField, "other-token")
+		ctx, w := newContext(form)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "dashboard").Return(testDashboardClient, nil)
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, ctx.Response().Status)
+		assert.Contains(t, w.Body.String(), "the form has expired")
+		assert.Contains(t, w.Body.String(), `<input type="hidden" name="csrf_token" value="`+testRandomToken+`">`)
+		assert.Contains(t, w.Header().Get(echo.HeaderSetCookie), authorizeCSRFCookie+"="+testRandomToken)
+	})
+
+	t.Run("Success MFA Required", func(t *testing.T) {
+		ctx, w := newContext(passwordForm("password"))
+		rctx := ctx.Request().Context()
+
+		confirmedAt := time.Now()
+		repo.EXPECT().FindOAuthClient(rctx, "dashboard").Return(testDashboardClient, nil)
+		repo.EXPECT().FindUserByPhoneNumber(rctx, user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(repository.TOTP{UserId: user.Id, ConfirmedAt: &confirmedAt}, nil)
+		repo.EXPECT().CreateMFAChallenge(rctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateMFAChallengeInput) error {
+				assert.Equal(t, util.HashToken(testRandomToken), input.TokenHash)
+				assert.Equal(t, "dashboard", input.DeviceLabel)
+				return nil
+			})
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+		assert.Contains(t, w.Body.String(), `<input type="hidden" name="mfa_token" value="`+testRandomToken+`">`)
+		assert.NotContains(t, w.Body.String(), `name="password"`)
+	})
+
+	t.Run("Success MFA Code", func(t *testing.T) {
+		form := newTestAuthorizationRequest()
+		form.Set("mfa_token", "mfa-token")
+		form.Set("code", code)
+		ctx, w := newContext(form)
+		rctx := ctx.Request().Context()
+
+		challenge := repository.MFAChallenge{Id: 9, UserId: user.Id, ExpiresAt: time.Now().Add(time.Minute)}
+		repo.EXPECT().FindOAuthClient(rctx, "dashboard").Return(testDashboardClient, nil)
+		repo.EXPECT().FindActiveMFAChallenge(rctx, util.HashToken("mfa-token")).Return(challenge, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().IncrementMFAChallengeAttempts(rctx, challenge.Id).Return(1, nil)
+		repo.EXPECT().FindTOTP(rctx, user.Id).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(rctx, user.Id, gomock.Any()).Return(true, nil)
+		repo.EXPECT().ConsumeMFAChallenge(rctx, challenge.Id).Return(true, nil)
+		expectAuthorizationCode(rctx)
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, ctx.Response().Status)
+		assert.Contains(t, w.Header().Get(echo.HeaderLocation), "code="+testRandomToken)
+	})
+
+	t.Run("Failed Expired MFA Token", func(t *testing.T) {
+		form := newTestAuthorizationRequest()
+		form.Set("mfa_token", "mfa-token")
+		form.Set("code", code)
+		ctx, w := newContext(form)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindOAuthClient(rctx, "dashboard").Return(testDashboardClient, nil)
+		repo.EXPECT().FindActiveMFAChallenge(rctx, util.HashToken("mfa-token")).Return(repository.MFAChallenge{}, nil)
+
+		err := s.SubmitOauthAuthorize(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, ctx.Response().Status)
+		assert.Contains(t, w.Body.String(), "invalid or expired mfa token")
+		assert.Contains(t, w.Body.String(), `name="password"`)
+	})
+}
+
+func TestServer_GetOauthUserinfo(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{Repository: repo}
+
+		verifiedAt = time.Now()
+		user       = repository.User{
+			Id:              1,
+			FullName:        "Sulaiman",
+			PhoneNumber:     "+62123132131",
+			PhoneVerifiedAt: &verifiedAt,
+		}
+		claims = &jwt.Claims{UserId: user.Id, SessionId: "family"}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(withUser bool) (echo.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/oauth/userinfo", nil)
+		rctx := context.WithValue(r.Context(), "Claims", claims)
+		if withUser {
+			rctx = context.WithValue(rctx, "UserID", user.Id)
+		}
+		return router.NewContext(r.WithContext(rctx), w), w
+	}
+
+	t.Run("Success Scoped Session", func(t *testing.T) {
+		ctx, w := newContext(true)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindSession(rctx, "family").
+			Return(repository.Session{Id: "family", UserId: user.Id, ClientId: "dashboard", Scope: "openid phone"}, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+
+		err := s.GetOauthUserinfo(ctx, generated.GetOauthUserinfoParams{})
+		assert.NoError(t, err)
+
+		res := generated.UserinfoResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		verified := true
+		assert.Equal(t, generated.UserinfoResponse{
+			Sub:                 "1",
+			PhoneNumber:         &user.PhoneNumber,
+			PhoneNumberVerified: &verified,
+		}, res)
+	})
+
+	t.Run("Success Own Session", func(t *testing.T) {
+		ctx, w := newContext(true)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindSession(rctx, "family").Return(repository.Session{Id: "family", UserId: user.Id}, nil)
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+
+		err := s.GetOauthUserinfo(ctx, generated.GetOauthUserinfoParams{})
+		assert.NoError(t, err)
+
+		res := generated.UserinfoResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "Sulaiman", *res.Name)
+		assert.Equal(t, user.PhoneNumber, *res.PhoneNumber)
+	})
+
+	t.Run("Failed Revoked Session", func(t *testing.T) {
+		ctx, _ := newContext(true)
+
+		repo.EXPECT().FindSession(ctx.Request().Context(), "family").Return(repository.Session{}, nil)
+
+		err := s.GetOauthUserinfo(ctx, generated.GetOauthUserinfoParams{})
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		ctx, _ := newContext(false)
+
+		err := s.GetOauthUserinfo(ctx, generated.GetOauthUserinfoParams{})
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestServer_IntrospectOauthToken(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revoked,
+		}
+		client = repository.OAuthClient{
+			ClientId:   "billing",
+			SecretHash: util.HashToken("billing-secret"),
+			Scopes:     []string{oauthScopeIntrospect},
+		}
+		claims = &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{
+				ID:        "access-token-id",
+				Issuer:    "sawitpro",
+				Subject:   "1",
+				Audience:  jwtv4.ClaimStrings{"sawitpro-user-service"},
+				IssuedAt:  jwtv4.NewNumericDate(time.Unix(1700000000, 0)),
+				NotBefore: jwtv4.NewNumericDate(time.Unix(1700000000, 0)),
+				ExpiresAt: jwtv4.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			UserId:    1,
+			SessionId: "session-id",
+		}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(form url.Values, basicAuth bool) (echo.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/oauth/introspect", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", echo.MIMEApplicationForm)
+		if basicAuth {
+			r.SetBasicAuth("billing", "billing-secret")
+		}
+		return router.NewContext(r, w), w
+	}
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) generated.IntrospectionResponse {
+		res := generated.IntrospectionResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+
+	t.Run("Success Access Token", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"token": {"access-token"}}, true)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		jwtSigner.EXPECT().ParseWithClaims("access-token").Return(claims, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+		assert.Equal(t, "no-store", w.Header().Get(echo.HeaderCacheControl))
+
+		res := decode(t, w)
+		assert.True(t, res.Active)
+		assert.Equal(t, generated.IntrospectionResponseTokenTypeAccessToken, *res.TokenType)
+		assert.Equal(t, "1", *res.Sub)
+		assert.Equal(t, "session-id", *res.Sid)
+		assert.Equal(t, "sawitpro-user-service", *res.Aud)
+		assert.Equal(t, claims.ExpiresAt.Unix(), *res.Exp)
+		assert.Equal(t, int64(1700000000), *res.Iat)
+	})
+
+	t.Run("Success Client Token", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"token": {"client-token"}}, true)
+
+		clientClaims := &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{
+				ID:        "client-token-id",
+				Subject:   "billing",
+				ExpiresAt: jwtv4.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			ClientId: "billing",
+			Scope:    "introspect",
+		}
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		jwtSigner.EXPECT().ParseWithClaims("client-token").Return(clientClaims, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.NoError(t, err)
+
+		res := decode(t, w)
+		assert.True(t, res.Active)
+		assert.Equal(t, "billing", *res.ClientId)
+		assert.Equal(t, "billing", *res.Sub)
+		assert.Equal(t, "introspect", *res.Scope)
+		assert.Nil(t, res.Sid)
+	})
+
+	t.Run("Success Refresh Token", func(t *testing.T) {
+		form := url.Values{
+			"token":           {"refresh-token"},
+			"token_type_hint": {"refresh_token"},
+			"client_id":       {"billing"},
+			"client_secret":   {"billing-secret"},
+		}
+		ctx, w := newContext(form, false)
+
+		expiresAt := time.Now().Add(time.Hour)
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), util.HashToken("refresh-token")).
+			Return(repository.RefreshToken{Id: 3, UserId: 1, FamilyId: "session-id", ExpiresAt: expiresAt}, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.NoError(t, err)
+
+		res := decode(t, w)
+		assert.True(t, res.Active)
+		assert.Equal(t, generated.IntrospectionResponseTokenTypeRefreshToken, *res.TokenType)
+		assert.Equal(t, "1", *res.Sub)
+		assert.Equal(t, "session-id", *res.Sid)
+		assert.Equal(t, expiresAt.Unix(), *res.Exp)
+	})
+
+	t.Run("Success Inactive Used Refresh Token", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"token": {"refresh-token"}, "token_type_hint": {"refresh_token"}}, true)
+
+		usedAt := time.Now()
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), util.HashToken("refresh-token")).
+			Return(repository.RefreshToken{Id: 3, UserId: 1, ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt}, nil)
+		jwtSigner.EXPECT().ParseWithClaims("refresh-token").Return(nil, errors.New("token is malformed"))
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"active\":false}\n", w.Body.String())
+	})
+
+	t.Run("Success Inactive Revoked Access Token", func(t *testing.T) {
+		ctx, w := newContext(url.Values{"token": {"access-token"}}, true)
+
+		assert.NoError(t, revoked.RevokeToken(context.Background(), claims.ID, claims.ExpiresAt.Time))
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+		jwtSigner.EXPECT().ParseWithClaims("access-token").Return(claims, nil)
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), util.HashToken("access-token")).
+			Return(repository.RefreshToken{}, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.NoError(t, err)
+		assert.False(t, decode(t, w).Active)
+	})
+
+	t.Run("Failed Invalid Client", func(t *testing.T) {
+		form := url.Values{"token": {"access-token"}, "client_id": {"billing"}, "client_secret": {"wrong"}}
+		ctx, w := newContext(form, false)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").Return(client, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+		assert.Equal(t, "invalid_client", err.(*echo.HTTPError).Message.(generated.OAuthErrorResponse).Error)
+		assert.Equal(t, `Basic realm="oauth"`, w.Header().Get(echo.HeaderWWWAuthenticate))
+	})
+
+	t.Run("Failed Missing Scope", func(t *testing.T) {
+		ctx, _ := newContext(url.Values{"token": {"access-token"}}, true)
+
+		repo.EXPECT().FindOAuthClient(ctx.Request().Context(), "billing").
+			Return(repository.OAuthClient{ClientId: "billing", SecretHash: client.SecretHash}, nil)
+
+		err := s.IntrospectOauthToken(ctx)
+		assert.Equal(t, http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestServer_RefreshUsersToken(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository:      repo,
+			jwt:             jwtSigner,
+			revocation:      revoked,
+			refreshTokenTTL: time.Hour,
+			random:          fakeRandomSource{},
+		}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(refreshToken string) echo.Context {
+		buff, _ := json.Marshal(generated.RefreshTokenRequest{RefreshToken: refreshToken})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/token/refresh", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(ctx.Request().Context(), token.Id).Return(true, nil)
+		repo.EXPECT().TouchSession(ctx.Request().Context(), token.FamilyId).Return(nil)
+		repo.EXPECT().FindSession(ctx.Request().Context(), token.FamilyId).
+			Return(repository.Session{Id: token.FamilyId, UserId: token.UserId}, nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), token.UserId).
+			Return([]repository.Role{{Name: "admin", Permissions: []string{"users:unlock"}}}, nil)
+		jwtSigner.EXPECT().CreateAccessToken(token.UserId, token.FamilyId, []string{"admin"}, []string{"users:unlock"}).Return("fdafafdasfasdfafasdf", nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().CreateRefreshToken(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreateRefreshTokenInput) error {
+				assert.Equal(t, token.FamilyId, input.FamilyId)
+				assert.NotEqual(t, token.TokenHash, input.TokenHash)
+				return nil
+			})
+
+		err := s.RefreshUsersToken(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Failed Session Not Found", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(ctx.Request().Context(), token.Id).Return(true, nil)
+		repo.EXPECT().TouchSession(ctx.Request().Context(), token.FamilyId).Return(nil)
+		repo.EXPECT().FindSession(ctx.Request().Context(), token.FamilyId).Return(repository.Session{}, nil)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, errInvalidRefreshToken, err)
+	})
+
+	t.Run("Failed Session Of Client", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(ctx.Request().Context(), token.Id).Return(true, nil)
+		repo.EXPECT().TouchSession(ctx.Request().Context(), token.FamilyId).Return(nil)
+		repo.EXPECT().FindSession(ctx.Request().Context(), token.FamilyId).
+			Return(repository.Session{Id: token.FamilyId, UserId: token.UserId, ClientId: "dashboard", Scope: "openid"}, nil)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, errInvalidRefreshToken, err)
+	})
+
+	t.Run("Failed Reused Token Revokes Family", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		usedAt := time.Now().Add(-time.Minute)
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "reused-family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(time.Hour),
+			UsedAt:    &usedAt,
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+		repo.EXPECT().RevokeRefreshTokenFamily(ctx.Request().Context(), token.FamilyId).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token"), err)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), &jwt.Claims{SessionId: token.FamilyId})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+
+	t.Run("Failed Concurrent Use Revokes Family", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "concurrent-family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+		repo.EXPECT().MarkRefreshTokenUsed(ctx.Request().Context(), token.Id).Return(false, nil)
+		repo.EXPECT().RevokeRefreshTokenFamily(ctx.Request().Context(), token.FamilyId).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token"), err)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), &jwt.Claims{SessionId: token.FamilyId})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+
+	t.Run("Failed Expired Token", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		token := repository.RefreshToken{
+			Id:        10,
+			UserId:    1,
+			FamilyId:  "family",
+			TokenHash: util.HashToken("refreshtoken"),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), token.TokenHash).Return(token, nil)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token"), err)
+	})
+
+	t.Run("Failed Unknown Token", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), util.HashToken("refreshtoken")).
+			Return(repository.RefreshToken{}, nil)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token"), err)
+	})
+
+	t.Run("Failed FindRefreshTokenByHash", func(t *testing.T) {
+		ctx := newContext("refreshtoken")
+
+		repo.EXPECT().FindRefreshTokenByHash(ctx.Request().Context(), util.HashToken("refreshtoken")).
+			Return(repository.RefreshToken{}, context.DeadlineExceeded)
+
+		err := s.RefreshUsersToken(ctx)
+		assert.Error(t, err)
+	})
+}
+
+// withClaims stores the claims in the request context like middleware.Auth.
+func withClaims(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), "Claims", claims)
+	if claims.IsClient() {
+		ctx = context.WithValue(ctx, "ClientID", claims.ClientId)
+	} else {
+		ctx = context.WithValue(ctx, "UserID", claims.UserId)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestServer_UsersLogout(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revoked,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		issuedAt := time.Now()
+		claims := &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{
+				ID:        "token-1",
+				IssuedAt:  jwtv4.NewNumericDate(issuedAt),
+				ExpiresAt: jwtv4.NewNumericDate(issuedAt.Add(time.Hour)),
+			},
+			UserId:    1,
+			SessionId: "family",
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout", nil)
+		r = withClaims(r, claims)
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().RevokeRefreshTokenFamily(ctx.Request().Context(), "family").Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.UsersLogout(ctx, generated.UsersLogoutParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+		isRevoked, err = revoked.IsRevoked(context.Background(), &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{ID: "token-2", IssuedAt: jwtv4.NewNumericDate(issuedAt)},
+			UserId:           1,
+			SessionId:        "family",
+		})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+		isRevoked, err = revoked.IsRevoked(context.Background(), &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{ID: "token-3", IssuedAt: jwtv4.NewNumericDate(issuedAt)},
+			UserId:           1,
+			SessionId:        "other-family",
+		})
+		assert.NoError(t, err)
+		assert.False(t, isRevoked)
+	})
+
+	t.Run("Failed Not Logged In", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout", nil)
+		ctx := router.NewContext(r, w)
+
+		err := s.UsersLogout(ctx, generated.UsersLogoutParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout", nil)
+		r = withClaims(r, &jwt.Claims{ClientId: "reporting"})
+		ctx := router.NewContext(r, w)
+
+		err := s.UsersLogout(ctx, generated.UsersLogoutParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in"), err)
+	})
+}
+
+func TestServer_UsersLogoutAll(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revoked,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		issuedAt := time.Now().Add(-time.Minute)
+		claims := &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{
+				ID:        "token-1",
+				IssuedAt:  jwtv4.NewNumericDate(issuedAt),
+				ExpiresAt: jwtv4.NewNumericDate(issuedAt.Add(time.Hour)),
+			},
+			UserId:    1,
+			SessionId: "session-1",
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout-all", nil)
+		r = withClaims(r, claims)
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().RevokeUserRefreshTokens(ctx.Request().Context(), int64(1)).Return([]string{"session-1", "session-2"}, nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.UsersLogoutAll(ctx, generated.UsersLogoutAllParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+		isRevoked, err = revoked.IsRevoked(context.Background(), &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{ID: "token-2", IssuedAt: jwtv4.NewNumericDate(issuedAt)},
+			UserId:           1,
+			SessionId:        "session-2",
+		})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+		isRevoked, err = revoked.IsRevoked(context.Background(), &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{ID: "token-3", IssuedAt: jwtv4.NewNumericDate(issuedAt)},
+			UserId:           1,
+			SessionId:        "session-3",
+		})
+		assert.NoError(t, err)
+		assert.False(t, isRevoked)
+	})
+
+	t.Run("Failed RevokeUserRefreshTokens", func(t *testing.T) {
+		claims := &jwt.Claims{UserId: 1}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout-all", nil)
+		r = withClaims(r, claims)
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().RevokeUserRefreshTokens(ctx.Request().Context(), int64(1)).Return(nil, context.DeadlineExceeded)
+
+		err := s.UsersLogoutAll(ctx, generated.UsersLogoutAllParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/logout-all", nil)
+		r = withClaims(r, &jwt.Claims{ClientId: "reporting"})
+		ctx := router.NewContext(r, w)
+
+		err := s.UsersLogoutAll(ctx, generated.UsersLogoutAllParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in"), err)
+	})
+}
+
+func TestServer_ListUsersSessions(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/sessions", nil)
+		r = withClaims(r, &jwt.Claims{UserId: 1, SessionId: "session-1"})
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().ListActiveSessions(ctx.Request().Context(), int64(1)).Return([]repository.Session{
+			{Id: "session-1", UserId: 1, DeviceLabel: "Field phone"},
+			{Id: "session-2", UserId: 1, UserAgent: "okhttp/4.12.0"},
+		}, nil)
+
+		err := s.ListUsersSessions(ctx, generated.ListUsersSessionsParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.SessionListResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Len(t, res.Sessions, 2)
+		assert.True(t, res.Sessions[0].Current)
+		assert.False(t, res.Sessions[1].Current)
+	})
+
+	t.Run("Failed ListActiveSessions", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/sessions", nil)
+		r = withClaims(r, &jwt.Claims{UserId: 1})
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().ListActiveSessions(ctx.Request().Context(), int64(1)).Return(nil, context.DeadlineExceeded)
+
+		err := s.ListUsersSessions(ctx, generated.ListUsersSessionsParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/sessions", nil)
+		r = withClaims(r, &jwt.Claims{ClientId: "reporting"})
+		ctx := router.NewContext(r, w)
+
+		err := s.ListUsersSessions(ctx, generated.ListUsersSessionsParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in"), err)
+	})
+}
+
+func TestServer_DeleteUsersSession(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revoked,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/v1/users/sessions/session-2", nil)
+		r = withClaims(r, &jwt.Claims{UserId: 1, SessionId: "session-1"})
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().RevokeSession(ctx.Request().Context(), int64(1), "session-2").Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.DeleteUsersSession(ctx, "session-2", generated.DeleteUsersSessionParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), &jwt.Claims{
+			RegisteredClaims: jwtv4.RegisteredClaims{ID: "token-1", IssuedAt: jwtv4.NewNumericDate(time.Now())},
+			UserId:           1,
+			SessionId:        "session-2",
+		})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+
+	t.Run("Failed Session Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/v1/users/sessions/session-3", nil)
+		r = withClaims(r, &jwt.Claims{UserId: 1, SessionId: "session-1"})
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().RevokeSession(ctx.Request().Context(), int64(1), "session-3").
+			Return(echo.NewHTTPError(http.StatusNotFound, "session not found"))
+
+		err := s.DeleteUsersSession(ctx, "session-3", generated.DeleteUsersSessionParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/v1/users/sessions/session-2", nil)
+		r = withClaims(r, &jwt.Claims{ClientId: "reporting"})
+		ctx := router.NewContext(r, w)
+
+		err := s.DeleteUsersSession(ctx, "session-2", generated.DeleteUsersSessionParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in"), err)
+	})
+}
+
+func TestServer_GetUsersProfile(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		ctx := router.NewContext(r, w)
+
+		user := repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: "+62123132131",
+			Password:    "fddasfa",
+			Salt:        "fdasfsa",
+		}
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
+			Return(user, nil)
+
+		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Success With Login Stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/profile?include_login_stats=true", nil)
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		ctx := router.NewContext(r, w)
+
+		verifiedAt := time.Now()
+		user := repository.User{
+			Id:                   1,
+			FullName:             "Sulaiman",
+			PhoneNumber:          "+62123132131",
+			Password:             "fddasfa",
+			Salt:                 "fdasfsa",
+			SuccessfulLoginCount: 3,
+			FailedLoginCount:     1,
+			PhoneVerifiedAt:      &verifiedAt,
+		}
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
+			Return(user, nil)
+
+		includeLoginStats := true
+		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{IncludeLoginStats: &includeLoginStats})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.GetProfileResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.True(t, res.PhoneVerified)
+		assert.Equal(t, &generated.LoginStats{SuccessfulLoginCount: 3, FailedLoginCount: 1}, res.LoginStats)
+	})
+
+	t.Run("Failed FindUserById", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		ctx := router.NewContext(r, w)
+
+		user := repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: "+62123132131",
+			Password:    "fddasfa",
+			Salt:        "fdasfsa",
+		}
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
+			Return(user, context.DeadlineExceeded)
+
+		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Invalid UserID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", nil)
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", "1"))
+		ctx := router.NewContext(r, w)
+
+		err := s.GetUsersProfile(ctx, generated.GetUsersProfileParams{})
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_UpdateUsersProfile(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		smsSender = notification.NewMockSMSSender(ctrl)
+		s         = &Server{
+			Repository:     repo,
+			jwt:            jwtSigner,
+			smsSender:      smsSender,
+			phoneParser:    phone.DefaultParser(),
+			random:         fakeRandomSource{},
+			passwordHasher: fakePasswordHasher{},
+		}
+		user = repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: "+62811111111",
+			Password:    "hashed:currentpassword",
+			Salt:        "fdasfsa",
+		}
+		currentPassword     = "currentpassword"
+		verificationMessage = "Your SawitPro verification code is 777777. It expires in 10 minutes."
+	)
+	defer ctrl.Finish()
+
+	newContext := func(req generated.UpdateProfileRequest) (echo.Context, *httptest.ResponseRecorder) {
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/v1/users/profile", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success FullName", func(t *testing.T) {
+		fullName := "Sulaiman Pro"
+		ctx, w := newContext(generated.UpdateProfileRequest{FullName: &fullName})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().UpdateUser(ctx.Request().Context(), &fullName, nil, user.Id).Return(nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.UpdateProfileResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.UpdateProfileResponse{Id: 1}, res)
+	})
+
+	t.Run("Success PhoneNumber Pending Verification", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, w := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), user.Id, gomock.Any()).Return(0, nil)
+		repo.EXPECT().CreatePhoneVerification(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreatePhoneVerificationInput) error {
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, phoneNumber, input.PhoneNumber)
+				assert.Equal(t, s.hashPhoneVerificationCode(user.Id, phoneNumber, "777777"), input.CodeHash)
+				return nil
+			})
+		smsSender.EXPECT().SendSMS(ctx.Request().Context(), phoneNumber, verificationMessage).Return(nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.UpdateProfileResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, generated.UpdateProfileResponse{Id: 1, PendingPhoneNumber: &phoneNumber}, res)
+	})
+
+	t.Run("Success Normalizes PhoneNumber", func(t *testing.T) {
+		phoneNumber := "0812-3456-789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		normalized := "+628123456789"
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), normalized).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), user.Id, gomock.Any()).Return(0, nil)
+		repo.EXPECT().CreatePhoneVerification(ctx.Request().Context(), gomock.Any()).Return(nil)
+		smsSender.EXPECT().SendSMS(ctx.Request().Context(), normalized, verificationMessage).Return(nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Success Same PhoneNumber", func(t *testing.T) {
+		phoneNumber := "0811-1111-11"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Success Within Resend Cooldown", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{Id: 3, UserId: user.Id, PhoneNumber: phoneNumber, CreatedAt: time.Now()}, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Failed UpdateUser", func(t *testing.T) {
+		fullName := "Sulaiman Pro"
+		ctx, _ := newContext(generated.UpdateProfileRequest{FullName: &fullName})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().UpdateUser(ctx.Request().Context(), &fullName, nil, user.Id).Return(context.DeadlineExceeded)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed SendSMS", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), user.Id, gomock.Any()).Return(0, nil)
+		repo.EXPECT().CreatePhoneVerification(ctx.Request().Context(), gomock.Any()).Return(nil)
+		smsSender.EXPECT().SendSMS(ctx.Request().Context(), phoneNumber, verificationMessage).
+			Return(context.DeadlineExceeded)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Rate Limited", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), user.Id, gomock.Any()).
+			Return(phoneVerificationRateLimit, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Equal(t, errPhoneVerificationRateLimited, err)
+	})
+
+	t.Run("Failed Rate Limited Keeps FullName", func(t *testing.T) {
+		fullName := "Sulaiman Pro"
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{FullName: &fullName, PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).Return(repository.User{}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), user.Id).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), user.Id, gomock.Any()).
+			Return(phoneVerificationRateLimit, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Equal(t, errPhoneVerificationRateLimited, err)
+	})
+
+	t.Run("Failed FindUserById", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, context.DeadlineExceeded)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Conflict PhoneNumber", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).
+			Return(repository.User{Id: 2, PhoneNumber: phoneNumber}, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusConflict, "phone number already existed"), err)
+	})
+
+	t.Run("Failed Missing Current Password", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "current_password is required to change the phone number"), err)
+	})
+
+	t.Run("Failed Wrong Current Password", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		wrongPassword := "wrongpassword"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &wrongPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(ctx.Request().Context(), int64(1)).Return(nil, nil)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusForbidden, "current password is incorrect"), err)
+	})
+
+	t.Run("Failed FindUserByPhoneNumber", func(t *testing.T) {
+		phoneNumber := "+628123456789"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber, CurrentPassword: &currentPassword})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), phoneNumber).
+			Return(repository.User{}, context.DeadlineExceeded)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Prefix PhoneNumber", func(t *testing.T) {
+		phoneNumber := "+12123132131"
+		ctx, _ := newContext(generated.UpdateProfileRequest{PhoneNumber: &phoneNumber})
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed NoContent", func(t *testing.T) {
+		ctx, _ := newContext(generated.UpdateProfileRequest{})
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+	})
+
+	t.Run("Failed Bind", func(t *testing.T) {
+		req := generated.UpdateProfileRequest{
+			PhoneNumber: nil,
+		}
+
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/1", bytes.NewBuffer(buff))
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		ctx := router.NewContext(r, w)
+
+		err := s.UpdateUsersProfile(ctx, generated.UpdateUsersProfileParams{})
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_VerifyUsersPhone(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revoked,
+		}
+		verification = repository.PhoneVerification{
+			Id:          3,
+			UserId:      1,
+			PhoneNumber: "+628123456789",
+			CodeHash:    s.hashPhoneVerificationCode(1, "+628123456789", "123456"),
+			ExpiresAt:   time.Now().Add(time.Minute),
+		}
+		invalidErr = echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification code")
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) echo.Context {
+		buff, _ := json.Marshal(generated.PhoneVerificationRequest{Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile/phone/verify", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		rctx := context.WithValue(r.Context(), "UserID", int64(1))
+		rctx = context.WithValue(rctx, "Claims", &jwt.Claims{UserId: 1, SessionId: "session-1"})
+		r = r.WithContext(rctx)
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).Return(verification, nil)
+		repo.EXPECT().IncrementPhoneVerificationAttempts(ctx.Request().Context(), verification.Id).Return(1, nil)
+		repo.EXPECT().ConfirmPhoneVerification(ctx.Request().Context(), verification.Id).Return(true, nil)
+		repo.EXPECT().RevokeOtherSessions(ctx.Request().Context(), int64(1), "session-1").
+			Return([]string{"session-2"}, nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), &jwt.Claims{UserId: 1, SessionId: "session-2"})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx := newContext("654321")
+
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).Return(verification, nil)
+		repo.EXPECT().IncrementPhoneVerificationAttempts(ctx.Request().Context(), verification.Id).Return(1, nil)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Too Many Attempts", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		exhausted := verification
+		exhausted.Attempts = phoneVerificationMaxAttempts
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).Return(exhausted, nil)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed No Pending Verification", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).
+			Return(repository.PhoneVerification{}, nil)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Already Confirmed", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).Return(verification, nil)
+		repo.EXPECT().IncrementPhoneVerificationAttempts(ctx.Request().Context(), verification.Id).Return(1, nil)
+		repo.EXPECT().ConfirmPhoneVerification(ctx.Request().Context(), verification.Id).Return(false, nil)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed PhoneNumber Taken", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		conflictErr := echo.NewHTTPError(http.StatusConflict, "phone number already existed")
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).Return(verification, nil)
+		repo.EXPECT().IncrementPhoneVerificationAttempts(ctx.Request().Context(), verification.Id).Return(1, nil)
+		repo.EXPECT().ConfirmPhoneVerification(ctx.Request().Context(), verification.Id).Return(false, conflictErr)
+
+		err := s.VerifyUsersPhone(ctx, generated.VerifyUsersPhoneParams{})
+		assert.Equal(t, conflictErr, err)
+	})
+}
+
+func TestServer_EnrollUsersTotp(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		box  = newTestMFABox(t)
+		s    = &Server{
+			Repository: repo,
+			random:     fakeRandomSource{},
+			mfaSecrets: box,
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+	)
+	defer ctrl.Finish()
+
+	newContext := func() (echo.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/mfa/totp", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", user.Id))
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext()
+
+		var sealed string
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(user, nil)
+		repo.EXPECT().SaveTOTPSecret(ctx.Request().Context(), user.Id, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, secret string) (bool, error) {
+				sealed = secret
+				return true, nil
+			})
+		repo.EXPECT().ReplaceRecoveryCodes(ctx.Request().Context(), user.Id, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, codeHashes []string) error {
+				assert.Len(t, codeHashes, recoveryCodeCount)
+				assert.Equal(t, s.hashRecoveryCode(user.Id, "777777777777"), codeHashes[0])
+				return nil
+			})
+
+		err := s.EnrollUsersTotp(ctx, generated.EnrollUsersTotpParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.TotpEnrollmentResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, totp.URI(totpIssuer, user.PhoneNumber, res.Secret), res.OtpauthUri)
+		assert.Len(t, res.RecoveryCodes, recoveryCodeCount)
+		assert.Equal(t, "7777-7777-7777", res.RecoveryCodes[0])
+
+		secret, err := box.Open(sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, res.Secret, string(secret))
+	})
+
+	t.Run("Failed Already Enabled", func(t *testing.T) {
+		ctx, _ := newContext()
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(user, nil)
+		repo.EXPECT().SaveTOTPSecret(ctx.Request().Context(), user.Id, gomock.Any()).Return(false, nil)
+
+		err := s.EnrollUsersTotp(ctx, generated.EnrollUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled"), err)
+	})
+
+	t.Run("Failed Not Configured", func(t *testing.T) {
+		ctx, _ := newContext()
+
+		err := (&Server{Repository: repo}).EnrollUsersTotp(ctx, generated.EnrollUsersTotpParams{})
+		assert.Equal(t, errMFANotConfigured, err)
+	})
+}
+
+func TestServer_ConfirmUsersTotp(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		box  = newTestMFABox(t)
+		s    = &Server{
+			Repository: repo,
+			mfaSecrets: box,
+		}
+		confirmed, code = newTestTOTP(t, box, 1)
+		pending         = repository.TOTP{UserId: confirmed.UserId, Secret: confirmed.Secret}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) echo.Context {
+		buff, _ := json.Marshal(generated.TotpCodeRequest{Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/mfa/totp/confirm", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(pending, nil)
+		repo.EXPECT().ConfirmTOTP(ctx.Request().Context(), int64(1), gomock.Any()).Return(nil)
+
+		err := s.ConfirmUsersTotp(ctx, generated.ConfirmUsersTotpParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx := newContext(wrongTOTPCode(code))
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(pending, nil)
+
+		err := s.ConfirmUsersTotp(ctx, generated.ConfirmUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Not Enrolled", func(t *testing.T) {
+		ctx := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(repository.TOTP{}, nil)
+
+		err := s.ConfirmUsersTotp(ctx, generated.ConfirmUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "no authenticator app is being enrolled"), err)
+	})
+
+	t.Run("Failed Already Enabled", func(t *testing.T) {
+		ctx := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(confirmed, nil)
+
+		err := s.ConfirmUsersTotp(ctx, generated.ConfirmUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled"), err)
+	})
+}
+
+func TestServer_DisableUsersTotp(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		box  = newTestMFABox(t)
+		s    = &Server{
+			Repository: repo,
+			mfaSecrets: box,
+		}
+		authenticator, code = newTestTOTP(t, box, 1)
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) echo.Context {
+		buff, _ := json.Marshal(generated.TotpCodeRequest{Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/v1/users/mfa/totp", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(ctx.Request().Context(), int64(1), gomock.Any()).Return(true, nil)
+		repo.EXPECT().DeleteTOTP(ctx.Request().Context(), int64(1)).Return(nil)
+
+		err := s.DisableUsersTotp(ctx, generated.DisableUsersTotpParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx := newContext(wrongTOTPCode(code))
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(authenticator, nil)
+
+		err := s.DisableUsersTotp(ctx, generated.DisableUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Not Enabled", func(t *testing.T) {
+		ctx := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(repository.TOTP{}, nil)
+
+		err := s.DisableUsersTotp(ctx, generated.DisableUsersTotpParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "two-factor authentication is not enabled"), err)
+	})
+}
+
+func TestServer_RegenerateUsersRecoveryCodes(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		box  = newTestMFABox(t)
+		s    = &Server{
+			Repository: repo,
+			random:     fakeRandomSource{},
+			mfaSecrets: box,
+		}
+		authenticator, code = newTestTOTP(t, box, 1)
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) (echo.Context, *httptest.ResponseRecorder) {
+		buff, _ := json.Marshal(generated.TotpCodeRequest{Code: code})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/mfa/recovery-codes", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
+		return router.NewContext(r, w), w
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, w := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(ctx.Request().Context(), int64(1), gomock.Any()).Return(true, nil)
+		repo.EXPECT().ReplaceRecoveryCodes(ctx.Request().Context(), int64(1), gomock.Len(recoveryCodeCount)).Return(nil)
+		repo.EXPECT().CreateAuditLog(ctx.Request().Context(), repository.CreateAuditLogInput{
+			ActorId:   1,
+			UserId:    1,
+			Action:    auditActionRecoveryCodesRegenerated,
+			IpAddress: "192.0.2.1",
+		}).Return(nil)
+
+		err := s.RegenerateUsersRecoveryCodes(ctx, generated.RegenerateUsersRecoveryCodesParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+
+		res := generated.RecoveryCodesResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Len(t, res.RecoveryCodes, recoveryCodeCount)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx, _ := newContext(wrongTOTPCode(code))
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(authenticator, nil)
+
+		err := s.RegenerateUsersRecoveryCodes(ctx, generated.RegenerateUsersRecoveryCodesParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Code Already Used", func(t *testing.T) {
+		ctx, _ := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(authenticator, nil)
+		repo.EXPECT().UseTOTPStep(ctx.Request().Context(), int64(1), gomock.Any()).Return(false, nil)
+
+		err := s.RegenerateUsersRecoveryCodes(ctx, generated.RegenerateUsersRecoveryCodesParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid two-factor authentication code"), err)
+	})
+
+	t.Run("Failed Not Enabled", func(t *testing.T) {
+		ctx, _ := newContext(code)
+
+		repo.EXPECT().FindTOTP(ctx.Request().Context(), int64(1)).Return(repository.TOTP{}, nil)
+
+		err := s.RegenerateUsersRecoveryCodes(ctx, generated.RegenerateUsersRecoveryCodesParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "two-factor authentication is not enabled"), err)
+	})
+}
+
+func TestServer_ChangeUsersPassword(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		revoked   = revocation.NewMemoryStore()
+		s         = &Server{
+			Repository:     repo,
+			jwt:            jwtSigner,
+			revocation:     revoked,
+			passwordPolicy: password.DefaultPolicy(),
+			passwordHasher: fakePasswordHasher{},
+			phoneParser:    phone.DefaultParser(),
+		}
+		user = repository.User{
+			Id:          1,
+			FullName:    "Sulaiman",
+			PhoneNumber: "+62123132131",
+			Password:    "hashed:currentpassword",
+			Salt:        "fdasfsa",
+		}
+	)
+	defer ctrl.Finish()
+
+	newContext := func(req generated.ChangePasswordRequest) echo.Context {
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/v1/users/password", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = withClaims(r, &jwt.Claims{UserId: 1, SessionId: "session-1"})
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "currentpassword", NewPassword: "kebunsawit2023"})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().UpdatePassword(ctx.Request().Context(), int64(1), "hashed:kebunsawit2023", "").Return(nil)
+		repo.EXPECT().RevokeOtherSessions(ctx.Request().Context(), int64(1), "session-1").
+			Return([]string{"session-2"}, nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+
+		isRevoked, err := revoked.IsRevoked(context.Background(), &jwt.Claims{UserId: 1, SessionId: "session-2"})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+
+	t.Run("Failed Wrong Current Password", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "wrongpassword", NewPassword: "kebunsawit2023"})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(ctx.Request().Context(), int64(1)).Return(nil, nil)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusForbidden, "current password is incorrect"), err)
+	})
+
+	t.Run("Failed Wrong Current Password Locks Account", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "wrongpassword", NewPassword: "kebunsawit2023"})
+
+		lockedUntil := time.Now().Add(15 * time.Minute)
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().IncrementFailedLogin(ctx.Request().Context(), int64(1)).Return(&lockedUntil, nil)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Equal(t, http.StatusLocked, err.(*echo.HTTPError).Code)
+		assert.NotEmpty(t, ctx.Response().Header().Get(echo.HeaderRetryAfter))
+	})
+
+	t.Run("Failed Account Locked", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "currentpassword", NewPassword: "kebunsawit2023"})
+
+		locked := user
+		lockedUntil := time.Now().Add(15 * time.Minute)
+		locked.LockedUntil = &lockedUntil
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(locked, nil)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Equal(t, http.StatusLocked, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Failed Invalid New Password", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "currentpassword", NewPassword: "sulaiman1"})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "password does not meet the password policy",
+			Errors: &[]generated.FieldError{
+				{Field: "new_password", Message: "new_password must not contain your phone number or name"},
+			},
+		}), err)
+	})
+
+	t.Run("Failed UpdatePassword", func(t *testing.T) {
+		ctx := newContext(generated.ChangePasswordRequest{CurrentPassword: "currentpassword", NewPassword: "kebunsawit2023"})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(user, nil)
+		repo.EXPECT().UpdatePassword(ctx.Request().Context(), int64(1), gomock.Any(), gomock.Any()).
+			Return(context.DeadlineExceeded)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Client Token", func(t *testing.T) {
+		buff, _ := json.Marshal(generated.ChangePasswordRequest{CurrentPassword: "currentpassword", NewPassword: "kebunsawit2023"})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/v1/users/password", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		r = withClaims(r, &jwt.Claims{ClientId: "reporting"})
+		ctx := router.NewContext(r, w)
+
+		err := s.ChangeUsersPassword(ctx, generated.ChangeUsersPasswordParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in"), err)
+	})
+}
+
+func TestServer_RequestUsersPasswordReset(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		smsSender = notification.NewMockSMSSender(ctrl)
+		s         = &Server{
+			Repository:  repo,
+			jwt:         jwtSigner,
+			smsSender:   smsSender,
+			random:      fakeRandomSource{},
+			phoneParser: phone.DefaultParser(),
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+
+		// the code is sent after the response, once the test runs the work
+		pending []func()
+	)
+	defer ctrl.Finish()
+
+	s.background = func(work func()) { pending = append(pending, work) }
+	runPending := func() {
+		for _, work := range pending {
+			work()
+		}
+		pending = nil
+	}
+
+	newContext := func(phoneNumber string) echo.Context {
+		buff, _ := json.Marshal(generated.PasswordResetRequestRequest{PhoneNumber: phoneNumber})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/password/reset-request", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(gomock.Any(), user.Id).
+			Return(repository.PasswordResetCode{}, nil)
+
+		repo.EXPECT().CreatePasswordResetCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreatePasswordResetCodeInput) error {
+				assert.Equal(t, user.Id, input.UserId)
+				assert.Equal(t, s.hashPasswordResetCode(user.Id, "777777"), input.CodeHash)
+				return nil
+			})
+		smsSender.EXPECT().SendSMS(gomock.Any(), user.PhoneNumber,
+			"Your SawitPro password reset code is 777777. It expires in 10 minutes.").Return(nil)
+
+		err := s.RequestUsersPasswordReset(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Unknown PhoneNumber", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(repository.User{}, nil)
+
+		err := s.RequestUsersPasswordReset(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success Within Resend Cooldown", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(gomock.Any(), user.Id).
+			Return(repository.PasswordResetCode{Id: 1, UserId: user.Id, CreatedAt: time.Now()}, nil)
+
+		err := s.RequestUsersPasswordReset(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+
+	t.Run("Success CreatePasswordResetCode Failure Only Logged", func(t *testing.T) {
+		ctx := newContext(user.PhoneNumber)
+
+		repo.EXPECT().FindUserByPhoneNumber(gomock.Any(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(gomock.Any(), user.Id).
+			Return(repository.PasswordResetCode{}, nil)
+		repo.EXPECT().CreatePasswordResetCode(gomock.Any(), gomock.Any()).Return(context.DeadlineExceeded)
+
+		err := s.RequestUsersPasswordReset(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusAccepted)
+		runPending()
+	})
+}
+
+func TestServer_ResetUsersPassword(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository:     repo,
+			jwt:            jwtSigner,
+			revocation:     revocation.NewMemoryStore(),
+			passwordHasher: fakePasswordHasher{},
+			phoneParser:    phone.DefaultParser(),
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+		code = repository.PasswordResetCode{
+			Id:        7,
+			UserId:    user.Id,
+			CodeHash:  s.hashPasswordResetCode(user.Id, "123456"),
+			ExpiresAt: time.Now().Add(time.Minute),
+		}
+		invalidErr = echo.NewHTTPError(http.StatusBadRequest, "invalid or expired reset code")
+	)
+	defer ctrl.Finish()
+
+	newContext := func(code string) echo.Context {
+		buff, _ := json.Marshal(generated.PasswordResetRequest{
+			PhoneNumber: user.PhoneNumber,
+			Code:        code,
+			NewPassword: "newpassword",
+		})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/password/reset", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		return router.NewContext(r, w)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(ctx.Request().Context(), user.Id).Return(code, nil)
+		repo.EXPECT().IncrementPasswordResetAttempts(ctx.Request().Context(), code.Id).Return(1, nil)
+		repo.EXPECT().ConsumePasswordResetCode(ctx.Request().Context(), code.Id).Return(true, nil)
+		repo.EXPECT().UpdatePassword(ctx.Request().Context(), user.Id, gomock.Any(), gomock.Any()).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().RevokeUserRefreshTokens(ctx.Request().Context(), user.Id).Return([]string{"session-1"}, nil)
+
+		err := s.ResetUsersPassword(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+	})
+
+	t.Run("Failed Wrong Code", func(t *testing.T) {
+		ctx := newContext("654321")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(ctx.Request().Context(), user.Id).Return(code, nil)
+		repo.EXPECT().IncrementPasswordResetAttempts(ctx.Request().Context(), code.Id).Return(1, nil)
+
+		err := s.ResetUsersPassword(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Too Many Attempts", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		exhausted := code
+		exhausted.Attempts = passwordResetMaxAttempts
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(ctx.Request().Context(), user.Id).Return(exhausted, nil)
+
+		err := s.ResetUsersPassword(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed Unknown PhoneNumber", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(repository.User{}, nil)
+
+		err := s.ResetUsersPassword(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+
+	t.Run("Failed No Active Code", func(t *testing.T) {
+		ctx := newContext("123456")
+
+		repo.EXPECT().FindUserByPhoneNumber(ctx.Request().Context(), user.PhoneNumber).Return(user, nil)
+		repo.EXPECT().FindActivePasswordResetCode(ctx.Request().Context(), user.Id).
+			Return(repository.PasswordResetCode{}, nil)
+
+		err := s.ResetUsersPassword(ctx)
+		assert.Equal(t, invalidErr, err)
+	})
+}
+
 func TestServer_CreateUsersProfile(t *testing.T) {
 	var (
 		ctrl   = gomock.NewController(t)
@@ -406,20 +3434,24 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 
 		repo      = repository.NewMockRepositoryInterface(ctrl)
 		jwtSigner = jwt.NewMockSigner(ctrl)
+		smsSender = notification.NewMockSMSSender(ctrl)
 		s         = &Server{
-			Repository: repo,
-			jwt:        jwtSigner,
+			Repository:     repo,
+			jwt:            jwtSigner,
+			smsSender:      smsSender,
+			passwordPolicy: password.DefaultPolicy(),
+			passwordHasher: fakePasswordHasher{},
+			phoneParser:    phone.DefaultParser(),
+			random:         fakeRandomSource{},
 		}
 	)
 	defer ctrl.Finish()
-	os.Setenv("TEST", "TRUE")
-	defer os.Setenv("TEST", "FALSE")
 
 	t.Run("Success", func(t *testing.T) {
 		req := generated.RegisterProfileRequest{
 			FullName:    "Sulaiman",
 			Password:    "testpassword123",
-			PhoneNumber: "+6232131",
+			PhoneNumber: "+628123456789",
 		}
 
 		buff, _ := json.Marshal(req)
@@ -432,8 +3464,7 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 		createReq := repository.CreateUserInput{
 			FullName:    req.FullName,
 			PhoneNumber: req.PhoneNumber,
-			Password:    "hashedpassworduser123123123",
-			Salt:        util.RandomSalt(),
+			Password:    "hashed:" + req.Password,
 		}
 		user := repository.CreateUserOutput{Id: 1}
 		repo.EXPECT().CreateUser(ctx.Request().Context(), createReq).Return(user, nil)
@@ -443,11 +3474,78 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 		assert.Equal(t, ctx.Response().Status, http.StatusOK)
 	})
 
+	t.Run("Success Verify Phone", func(t *testing.T) {
+		verifyPhone := true
+		req := generated.RegisterProfileRequest{
+			FullName:    "Sulaiman",
+			Password:    "testpassword123",
+			PhoneNumber: "0812-3456-789",
+			VerifyPhone: &verifyPhone,
+		}
+
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		ctx := router.NewContext(r, w)
+
+		phoneNumber := "+628123456789"
+		repo.EXPECT().CreateUser(ctx.Request().Context(), repository.CreateUserInput{
+			FullName:    req.FullName,
+			PhoneNumber: phoneNumber,
+			Password:    "hashed:" + req.Password,
+		}).Return(repository.CreateUserOutput{Id: 1}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), int64(1), gomock.Any()).Return(0, nil)
+		repo.EXPECT().CreatePhoneVerification(ctx.Request().Context(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.CreatePhoneVerificationInput) error {
+				assert.Equal(t, int64(1), input.UserId)
+				assert.Equal(t, phoneNumber, input.PhoneNumber)
+				assert.Equal(t, s.hashPhoneVerificationCode(1, phoneNumber, "777777"), input.CodeHash)
+				return nil
+			})
+		smsSender.EXPECT().SendSMS(ctx.Request().Context(), phoneNumber,
+			"Your SawitPro verification code is 777777. It expires in 10 minutes.").Return(nil)
+
+		err := s.CreateUsersProfile(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
+	t.Run("Success SendSMS Failure Only Logged", func(t *testing.T) {
+		verifyPhone := true
+		req := generated.RegisterProfileRequest{
+			FullName:    "Sulaiman",
+			Password:    "testpassword123",
+			PhoneNumber: "+628123456789",
+			VerifyPhone: &verifyPhone,
+		}
+
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		ctx := router.NewContext(r, w)
+
+		repo.EXPECT().CreateUser(ctx.Request().Context(), gomock.Any()).Return(repository.CreateUserOutput{Id: 1}, nil)
+		repo.EXPECT().FindActivePhoneVerification(ctx.Request().Context(), int64(1)).
+			Return(repository.PhoneVerification{}, nil)
+		repo.EXPECT().CountPhoneVerificationsSince(ctx.Request().Context(), int64(1), gomock.Any()).Return(0, nil)
+		repo.EXPECT().CreatePhoneVerification(ctx.Request().Context(), gomock.Any()).Return(nil)
+		smsSender.EXPECT().SendSMS(ctx.Request().Context(), req.PhoneNumber, gomock.Any()).
+			Return(context.DeadlineExceeded)
+
+		err := s.CreateUsersProfile(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusOK)
+	})
+
 	t.Run("Failed CreateUser", func(t *testing.T) {
 		req := generated.RegisterProfileRequest{
 			FullName:    "Sulaiman",
 			Password:    "testpassword123",
-			PhoneNumber: "+6232131",
+			PhoneNumber: "+628123456789",
 		}
 
 		buff, _ := json.Marshal(req)
@@ -457,19 +3555,36 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 		r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(1)))
 		ctx := router.NewContext(r, w)
 
-		createReq := repository.CreateUserInput{
-			FullName:    req.FullName,
-			PhoneNumber: req.PhoneNumber,
-			Password:    "hashedpassworduser123123123",
-			Salt:        util.RandomSalt(),
-		}
 		user := repository.CreateUserOutput{Id: 1}
-		repo.EXPECT().CreateUser(ctx.Request().Context(), createReq).Return(user, context.DeadlineExceeded)
+		repo.EXPECT().CreateUser(ctx.Request().Context(), gomock.Any()).Return(user, context.DeadlineExceeded)
 
 		err := s.CreateUsersProfile(ctx)
 		assert.Error(t, err)
 	})
 
+	t.Run("Failed Weak Password", func(t *testing.T) {
+		req := generated.RegisterProfileRequest{
+			FullName:    "Sulaiman",
+			Password:    "password",
+			PhoneNumber: "+628123456789",
+		}
+
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/profile", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		ctx := router.NewContext(r, w)
+
+		err := s.CreateUsersProfile(ctx)
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "password does not meet the password policy",
+			Errors: &[]generated.FieldError{
+				{Field: "password", Message: "password must contain a digit"},
+				{Field: "password", Message: "password is too common"},
+			},
+		}), err)
+	})
+
 	t.Run("Failed Prefix PhoneNumber", func(t *testing.T) {
 		req := generated.RegisterProfileRequest{
 			FullName:    "Sulaiman",
@@ -485,7 +3600,13 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 		ctx := router.NewContext(r, w)
 
 		err := s.CreateUsersProfile(ctx)
-		assert.Error(t, err)
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "invalid phone number",
+			Errors: &[]generated.FieldError{{
+				Field:   "phone_number",
+				Message: "phone_number has a country calling code that is not supported",
+			}},
+		}), err)
 	})
 
 	t.Run("Failed Bind", func(t *testing.T) {
@@ -505,3 +3626,619 @@ func TestServer_CreateUsersProfile(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+// newAdminContext returns the context of a request to an admin endpoint by
+// the admin with id 99.
+func newAdminContext(router *echo.Echo, method, target string, body any) echo.Context {
+	var buff []byte
+	if body != nil {
+		buff, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, bytes.NewBuffer(buff))
+	r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+	r = r.WithContext(context.WithValue(r.Context(), "UserID", int64(99)))
+	return router.NewContext(r, w)
+}
+
+func TestServer_ListUsers(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{Repository: repo, phoneParser: phone.DefaultParser()}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		var (
+			name        = "sul"
+			phone       = "+6212"
+			status      = generated.Locked
+			createdFrom = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			createdTo   = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+			sort        = generated.Name
+			order       = generated.Desc
+			limit       = 10
+		)
+		lockedUntil := time.Now().Add(time.Hour)
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			Name:        name,
+			PhoneNumber: phone,
+			Status:      repository.UserStatusLocked,
+			CreatedFrom: &createdFrom,
+			CreatedTo:   &createdTo,
+			SortBy:      repository.UserSortName,
+			Descending:  true,
+			Limit:       limit + 1,
+		}).Return([]repository.User{{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131", LockedUntil: &lockedUntil}}, nil)
+
+		err := s.ListUsers(ctx, generated.ListUsersParams{
+			Name:        &name,
+			PhoneNumber: &phone,
+			Status:      &status,
+			CreatedFrom: &createdFrom,
+			CreatedTo:   &createdTo,
+			Sort:        &sort,
+			Order:       &order,
+			Limit:       &limit,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+
+		var res generated.AdminUserListResponse
+		assert.NoError(t, json.Unmarshal(ctx.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &res))
+		assert.Len(t, res.Users, 1)
+		assert.Equal(t, generated.Locked, res.Users[0].Status)
+		assert.Nil(t, res.Users[0].Roles)
+		assert.Nil(t, res.NextCursor)
+	})
+
+	t.Run("Success Default Limit", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			SortBy: repository.UserSortId,
+			Limit:  listUsersDefaultLimit + 1,
+		}).Return(nil, nil)
+
+		err := s.ListUsers(ctx, generated.ListUsersParams{})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"users":[]}`, ctx.Response().Writer.(*httptest.ResponseRecorder).Body.String())
+	})
+
+	t.Run("Success Local Phone Number Prefix", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		prefix := "0812"
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			PhoneNumber: "+62812",
+			SortBy:      repository.UserSortId,
+			Limit:       listUsersDefaultLimit + 1,
+		}).Return(nil, nil)
+
+		err := s.ListUsers(ctx, generated.ListUsersParams{PhoneNumber: &prefix})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Success Phone Number Prefix With Decoded Plus", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		prefix := " 62812"
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			PhoneNumber: "+62812",
+			SortBy:      repository.UserSortId,
+			Limit:       listUsersDefaultLimit + 1,
+		}).Return(nil, nil)
+
+		err := s.ListUsers(ctx, generated.ListUsersParams{PhoneNumber: &prefix})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Failed Invalid Phone Number Prefix", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		prefix := "abc"
+		err := s.ListUsers(ctx, generated.ListUsersParams{PhoneNumber: &prefix})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid phone_number"), err)
+	})
+
+	t.Run("Success Next Page", func(t *testing.T) {
+		var (
+			sort      = generated.CreatedAt
+			limit     = 2
+			createdAt = time.Date(2024, 1, 1, 0, 0, 0, 123456000, time.UTC)
+			users     = []repository.User{
+				{Id: 1, CreatedAt: createdAt},
+				{Id: 2, CreatedAt: createdAt},
+				{Id: 3, CreatedAt: createdAt.Add(time.Hour)},
+			}
+		)
+
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			SortBy: repository.UserSortCreatedAt,
+			Limit:  limit + 1,
+		}).Return(users, nil)
+
+		err := s.ListUsers(ctx, generated.ListUsersParams{Sort: &sort, Limit: &limit})
+		assert.NoError(t, err)
+
+		var res generated.AdminUserListResponse
+		assert.NoError(t, json.Unmarshal(ctx.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &res))
+		assert.Len(t, res.Users, limit)
+		assert.NotNil(t, res.NextCursor)
+
+		// the cursor continues after the last user returned
+		ctx = newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+		repo.EXPECT().ListUsers(ctx.Request().Context(), repository.ListUsersInput{
+			SortBy: repository.UserSortCreatedAt,
+			After:  &repository.UserKey{Id: 2, Value: "2024-01-01T00:00:00.123456Z"},
+			Limit:  limit + 1,
+		}).Return(users[2:], nil)
+
+		err = s.ListUsers(ctx, generated.ListUsersParams{Sort: &sort, Limit: &limit, Cursor: res.NextCursor})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Failed Cursor Of Another Order", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		order := generated.Desc
+		cursor := encodeUserCursor(repository.UserKey{Id: 2}, repository.UserSortId, false)
+		err := s.ListUsers(ctx, generated.ListUsersParams{Order: &order, Cursor: &cursor})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor"), err)
+	})
+
+	t.Run("Failed Invalid Cursor", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		sort := generated.CreatedAt
+		cursor := encodeUserCursor(repository.UserKey{Id: 2, Value: "yesterday"}, repository.UserSortCreatedAt, false)
+		err := s.ListUsers(ctx, generated.ListUsersParams{Sort: &sort, Cursor: &cursor})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor"), err)
+
+		cursor = "not a cursor"
+		err = s.ListUsers(ctx, generated.ListUsersParams{Cursor: &cursor})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor"), err)
+	})
+
+	t.Run("Failed Invalid Created Range", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		createdFrom := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		createdTo := createdFrom.Add(-time.Hour)
+		err := s.ListUsers(ctx, generated.ListUsersParams{CreatedFrom: &createdFrom, CreatedTo: &createdTo})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "created_to must be after created_from"), err)
+	})
+
+	t.Run("Failed Invalid Limit", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		limit := listUsersMaxLimit + 1
+		err := s.ListUsers(ctx, generated.ListUsersParams{Limit: &limit})
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Failed Invalid Sort", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		sort := generated.ListUsersParamsSort("password")
+		err := s.ListUsers(ctx, generated.ListUsersParams{Sort: &sort})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid sort"), err)
+	})
+
+	t.Run("Failed Invalid Status", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users", nil)
+
+		status := generated.UserStatus("banned")
+		err := s.ListUsers(ctx, generated.ListUsersParams{Status: &status})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "invalid status"), err)
+	})
+}
+
+func TestServer_GetUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{Repository: repo}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users/1", nil)
+
+		verifiedAt := time.Now()
+		user := repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131", PhoneVerifiedAt: &verifiedAt}
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(user, nil)
+		repo.EXPECT().FindUserRoles(ctx.Request().Context(), user.Id).
+			Return([]repository.Role{{Name: "admin", Permissions: []string{"users:read"}}}, nil)
+
+		err := s.GetUser(ctx, user.Id, generated.GetUserParams{})
+		assert.NoError(t, err)
+
+		var res generated.AdminUser
+		assert.NoError(t, json.Unmarshal(ctx.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &res))
+		assert.Equal(t, user.FullName, res.FullName)
+		assert.True(t, res.PhoneVerified)
+		assert.Equal(t, generated.Active, res.Status)
+		assert.Equal(t, &[]string{"admin"}, res.Roles)
+	})
+
+	t.Run("Failed Not Found", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodGet, "/v1/admin/users/1", nil)
+
+		notFound := echo.NewHTTPError(http.StatusNotFound, "user not found")
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(repository.User{}, notFound)
+
+		err := s.GetUser(ctx, 1, generated.GetUserParams{})
+		assert.Equal(t, notFound, err)
+	})
+}
+
+func TestServer_CreateUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{
+			Repository:     repo,
+			passwordHasher: fakePasswordHasher{},
+			phoneParser:    phone.DefaultParser(),
+		}
+		verified = true
+		req      = generated.AdminCreateUserRequest{
+			FullName:      "Sulaiman",
+			PhoneNumber:   "08123132131",
+			Password:      "kebun sawit 2023",
+			PhoneVerified: &verified,
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users", req)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().CreateUserAccount(rctx, repository.CreateUserAccountInput{
+			CreateUserInput: repository.CreateUserInput{
+				FullName:    req.FullName,
+				PhoneNumber: "+628123132131",
+				Password:    "hashed:" + req.Password,
+			},
+			PhoneVerified: true,
+		}, repository.CreateAuditLogInput{
+			ActorId:   99,
+			Action:    auditActionUserCreated,
+			IpAddress: "192.0.2.1",
+			Details: map[string]any{
+				"full_name":      req.FullName,
+				"phone_number":   "+628123132131",
+				"phone_verified": true,
+			},
+		}).Return(repository.CreateUserOutput{Id: 1}, nil)
+		repo.EXPECT().FindUserById(rctx, int64(1)).
+			Return(repository.User{Id: 1, FullName: req.FullName, PhoneNumber: "+628123132131"}, nil)
+
+		err := s.CreateUser(ctx, generated.CreateUserParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, ctx.Response().Status)
+	})
+
+	t.Run("Failed Phone Number Exists", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users", req)
+
+		conflict := echo.NewHTTPError(http.StatusConflict, "phone number already existed")
+		repo.EXPECT().CreateUserAccount(ctx.Request().Context(), gomock.Any(), gomock.Any()).
+			Return(repository.CreateUserOutput{}, conflict)
+
+		err := s.CreateUser(ctx, generated.CreateUserParams{})
+		assert.Equal(t, conflict, err)
+	})
+
+	t.Run("Failed Invalid UserID", func(t *testing.T) {
+		buff, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/admin/users", bytes.NewBuffer(buff))
+		r.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		ctx := router.NewContext(r, w)
+
+		err := s.CreateUser(ctx, generated.CreateUserParams{})
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_UpdateUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{
+			Repository:  repo,
+			phoneParser: phone.DefaultParser(),
+		}
+		verifiedAt = time.Now()
+		user       = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131", PhoneVerifiedAt: &verifiedAt}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success New Phone Number Is Not Verified", func(t *testing.T) {
+		var (
+			name  = "Sulaiman Baru"
+			phone = "08987654321"
+		)
+		ctx := newAdminContext(router, http.MethodPatch, "/v1/admin/users/1",
+			generated.AdminUpdateUserRequest{FullName: &name, PhoneNumber: &phone})
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().UpdateUserAccount(rctx, user.Id, gomock.Any(), repository.CreateAuditLogInput{
+			ActorId:   99,
+			UserId:    user.Id,
+			Action:    auditActionUserUpdated,
+			IpAddress: "192.0.2.1",
+			Details: map[string]any{
+				"full_name":      repository.AuditChange{Old: user.FullName, New: name},
+				"phone_number":   repository.AuditChange{Old: user.PhoneNumber, New: "+628987654321"},
+				"phone_verified": repository.AuditChange{Old: true, New: false},
+			},
+		}).DoAndReturn(func(_ context.Context, _ int64, input repository.UpdateUserAccountInput, _ repository.CreateAuditLogInput) error {
+			assert.Equal(t, name, *input.FullName)
+			assert.Equal(t, "+628987654321", *input.PhoneNumber)
+			assert.False(t, *input.PhoneVerified)
+			return nil
+		})
+		repo.EXPECT().FindUserById(rctx, user.Id).
+			Return(repository.User{Id: 1, FullName: name, PhoneNumber: "+628987654321"}, nil)
+
+		err := s.UpdateUser(ctx, user.Id, generated.UpdateUserParams{})
+		assert.NoError(t, err)
+
+		var res generated.AdminUser
+		assert.NoError(t, json.Unmarshal(ctx.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &res))
+		assert.Equal(t, name, res.FullName)
+		assert.False(t, res.PhoneVerified)
+	})
+
+	t.Run("Success Nothing Changed", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPatch, "/v1/admin/users/1",
+			generated.AdminUpdateUserRequest{PhoneNumber: &user.PhoneNumber})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(user, nil)
+
+		err := s.UpdateUser(ctx, user.Id, generated.UpdateUserParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, ctx.Response().Status)
+	})
+
+	t.Run("Failed Not Found", func(t *testing.T) {
+		name := "Sulaiman Baru"
+		ctx := newAdminContext(router, http.MethodPatch, "/v1/admin/users/1",
+			generated.AdminUpdateUserRequest{FullName: &name})
+
+		notFound := echo.NewHTTPError(http.StatusNotFound, "user not found")
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(repository.User{}, notFound)
+
+		err := s.UpdateUser(ctx, user.Id, generated.UpdateUserParams{})
+		assert.Equal(t, notFound, err)
+	})
+}
+
+func TestServer_ResetUserPassword(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository:     repo,
+			jwt:            jwtSigner,
+			revocation:     revocation.NewMemoryStore(),
+			passwordHasher: fakePasswordHasher{},
+			passwordPolicy: password.Policy{MinLength: 8},
+			phoneParser:    phone.DefaultParser(),
+		}
+		user = repository.User{Id: 1, FullName: "Sulaiman", PhoneNumber: "+62123132131"}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/password",
+			generated.AdminPasswordResetRequest{NewPassword: "newpassword"})
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindUserById(rctx, user.Id).Return(user, nil)
+		repo.EXPECT().ResetUserPassword(rctx, user.Id, "hashed:newpassword", repository.CreateAuditLogInput{
+			ActorId:   99,
+			UserId:    user.Id,
+			Action:    auditActionUserPasswordReset,
+			IpAddress: "192.0.2.1",
+		}).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().RevokeUserRefreshTokens(rctx, user.Id).Return([]string{"session-1"}, nil)
+
+		err := s.ResetUserPassword(ctx, user.Id, generated.ResetUserPasswordParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, ctx.Response().Status)
+	})
+
+	t.Run("Failed Password Policy", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/password",
+			generated.AdminPasswordResetRequest{NewPassword: "short"})
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), user.Id).Return(user, nil)
+
+		err := s.ResetUserPassword(ctx, user.Id, generated.ResetUserPasswordParams{})
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestServer_LockUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revocation.NewMemoryStore(),
+		}
+		lockedUntil = time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/lock",
+			generated.LockUserRequest{LockedUntil: lockedUntil})
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindUserById(rctx, int64(1)).Return(repository.User{Id: 1}, nil)
+		repo.EXPECT().LockUser(rctx, int64(1), lockedUntil, repository.CreateAuditLogInput{
+			ActorId:   99,
+			UserId:    1,
+			Action:    auditActionUserLocked,
+			IpAddress: "192.0.2.1",
+			Details: map[string]any{
+				"locked_until": repository.AuditChange{Old: (*time.Time)(nil), New: lockedUntil},
+			},
+		}).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().RevokeUserRefreshTokens(rctx, int64(1)).Return([]string{"session-1"}, nil)
+
+		err := s.LockUser(ctx, 1, generated.LockUserParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, ctx.Response().Status)
+	})
+
+	t.Run("Failed Time In The Past", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/lock",
+			generated.LockUserRequest{LockedUntil: time.Now().Add(-time.Hour)})
+
+		err := s.LockUser(ctx, 1, generated.LockUserParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "locked_until must be in the future"), err)
+	})
+
+	t.Run("Failed Lock Self", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/99/lock",
+			generated.LockUserRequest{LockedUntil: lockedUntil})
+
+		err := s.LockUser(ctx, 99, generated.LockUserParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "admins can not lock themselves"), err)
+	})
+}
+
+func TestServer_UnlockUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo = repository.NewMockRepositoryInterface(ctrl)
+		s    = &Server{Repository: repo}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/unlock", nil)
+
+		lockedUntil := time.Now().Add(time.Hour)
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).
+			Return(repository.User{Id: 1, LockedUntil: &lockedUntil}, nil)
+		repo.EXPECT().UnlockUser(ctx.Request().Context(), int64(1), repository.CreateAuditLogInput{
+			ActorId:   99,
+			UserId:    1,
+			Action:    auditActionUserUnlocked,
+			IpAddress: "192.0.2.1",
+			Details: map[string]any{
+				"locked_until": repository.AuditChange{Old: &lockedUntil, New: nil},
+			},
+		}).Return(nil)
+
+		err := s.UnlockUser(ctx, 1, generated.UnlockUserParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, ctx.Response().Status, http.StatusNoContent)
+	})
+
+	t.Run("Failed UnlockUser", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/unlock", nil)
+
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(repository.User{Id: 1}, nil)
+		repo.EXPECT().UnlockUser(ctx.Request().Context(), int64(1), gomock.Any()).Return(context.DeadlineExceeded)
+
+		err := s.UnlockUser(ctx, 1, generated.UnlockUserParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Invalid UserID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/admin/users/1/unlock", nil)
+		ctx := router.NewContext(r, w)
+
+		err := s.UnlockUser(ctx, 1, generated.UnlockUserParams{})
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_DeactivateUser(t *testing.T) {
+	var (
+		ctrl   = gomock.NewController(t)
+		router = echo.New()
+
+		repo      = repository.NewMockRepositoryInterface(ctrl)
+		jwtSigner = jwt.NewMockSigner(ctrl)
+		s         = &Server{
+			Repository: repo,
+			jwt:        jwtSigner,
+			revocation: revocation.NewMemoryStore(),
+		}
+	)
+	defer ctrl.Finish()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/deactivate", nil)
+		rctx := ctx.Request().Context()
+
+		repo.EXPECT().FindUserById(rctx, int64(1)).Return(repository.User{Id: 1}, nil)
+		repo.EXPECT().DeactivateUser(rctx, int64(1), repository.CreateAuditLogInput{
+			ActorId:   99,
+			UserId:    1,
+			Action:    auditActionUserDeactivated,
+			IpAddress: "192.0.2.1",
+			Details: map[string]any{
+				"status": repository.AuditChange{Old: repository.UserStatusActive, New: repository.UserStatusDeactivated},
+			},
+		}).Return(nil)
+		jwtSigner.EXPECT().AccessTokenTTL().Return(15 * time.Minute)
+		repo.EXPECT().RevokeUserRefreshTokens(rctx, int64(1)).Return([]string{"session-1"}, nil)
+
+		err := s.DeactivateUser(ctx, 1, generated.DeactivateUserParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, ctx.Response().Status)
+	})
+
+	t.Run("Failed Not Found", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/1/deactivate", nil)
+
+		notFound := echo.NewHTTPError(http.StatusNotFound, "user not found")
+		repo.EXPECT().FindUserById(ctx.Request().Context(), int64(1)).Return(repository.User{}, notFound)
+
+		err := s.DeactivateUser(ctx, 1, generated.DeactivateUserParams{})
+		assert.Equal(t, notFound, err)
+	})
+
+	t.Run("Failed Deactivate Self", func(t *testing.T) {
+		ctx := newAdminContext(router, http.MethodPost, "/v1/admin/users/99/deactivate", nil)
+
+		err := s.DeactivateUser(ctx, 99, generated.DeactivateUserParams{})
+		assert.Equal(t, echo.NewHTTPError(http.StatusBadRequest, "admins can not deactivate themselves"), err)
+	})
+}
@@ -0,0 +1,23 @@
+package handler
+
+// PasswordHasher hashes and verifies user passwords, see password.Hasher.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash and
+	// whether the hash should be replaced by a fresh one.
+	Verify(password, encoded, legacySalt string) (match, needsRehash bool, err error)
+	// DummyHash returns a valid hash to compare against when there is no user,
+	// so that a failed lookup takes as long as a wrong password.
+	DummyHash() string
+}
+
+// RandomSource provides the random values the handlers hand out, such as
+// refresh tokens, one-time codes and session ids.
+type RandomSource interface {
+	// Token returns an url-safe opaque token made of n random bytes.
+	Token(n int) (string, error)
+	// Digits returns a numeric code of n digits.
+	Digits(n int) (string, error)
+	// UUID returns a random (version 4) UUID.
+	UUID() string
+}
@@ -3,21 +3,101 @@ package handler
 import (
 	"github.com/SawitProRecruitment/UserService/repository"
 	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/SawitProRecruitment/UserService/shared/notification"
+	"github.com/SawitProRecruitment/UserService/shared/password"
+	"github.com/SawitProRecruitment/UserService/shared/phone"
+	"github.com/SawitProRecruitment/UserService/shared/revocation"
+	"github.com/SawitProRecruitment/UserService/shared/secretbox"
+	"github.com/SawitProRecruitment/UserService/shared/util"
+	"github.com/google/uuid"
+	"time"
 )
 
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
 type Server struct {
 	Repository repository.RepositoryInterface
 	jwt        jwt.Signer
+	revocation revocation.Store
+	smsSender  notification.SMSSender
+
+	passwordPolicy  password.Policy
+	passwordHasher  PasswordHasher
+	phoneParser     *phone.Parser
+	random          RandomSource
+	refreshTokenTTL time.Duration
+	// mfaSecrets encrypts TOTP secrets, two-factor authentication is not
+	// available when it is nil
+	mfaSecrets *secretbox.Box
+	// codeHashKey keys the hashes of the codes sent by SMS and of the
+	// recovery codes, see util.HashCode
+	codeHashKey []byte
+	// background runs work after the response is sent, it runs the work
+	// right away when nil
+	background func(work func())
 }
 
 type NewServerOptions struct {
 	Repository repository.RepositoryInterface
 	JWT        jwt.Signer
+	Revocation revocation.Store
+	SMSSender  notification.SMSSender
+
+	PasswordPolicy  password.Policy
+	PasswordHasher  PasswordHasher
+	PhoneParser     *phone.Parser
+	RandomSource    RandomSource
+	RefreshTokenTTL time.Duration
+	MFASecretBox    *secretbox.Box
+	CodeHashKey     []byte
 }
 
 func NewServer(opts NewServerOptions) *Server {
+	if opts.PasswordPolicy == (password.Policy{}) {
+		opts.PasswordPolicy = password.DefaultPolicy()
+	}
+	if opts.PasswordHasher == nil {
+		opts.PasswordHasher = password.DefaultHasher()
+	}
+	if opts.PhoneParser == nil {
+		opts.PhoneParser = phone.DefaultParser()
+	}
+	if opts.RandomSource == nil {
+		opts.RandomSource = cryptoRandom{}
+	}
+	if opts.RefreshTokenTTL == 0 {
+		opts.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
 	return &Server{
-		Repository: opts.Repository,
-		jwt:        opts.JWT,
+		Repository:      opts.Repository,
+		jwt:             opts.JWT,
+		revocation:      opts.Revocation,
+		smsSender:       opts.SMSSender,
+		passwordPolicy:  opts.PasswordPolicy,
+		passwordHasher:  opts.PasswordHasher,
+		phoneParser:     opts.PhoneParser,
+		random:          opts.RandomSource,
+		refreshTokenTTL: opts.RefreshTokenTTL,
+		mfaSecrets:      opts.MFASecretBox,
+		codeHashKey:     opts.CodeHashKey,
+		background:      func(work func()) { go work() },
 	}
 }
+
+// runInBackground runs the work without holding up the response.
+func (s *Server) runInBackground(work func()) {
+	if s.background == nil {
+		work()
+		return
+	}
+	s.background(work)
+}
+
+// cryptoRandom is the RandomSource backed by crypto/rand.
+type cryptoRandom struct{}
+
+func (cryptoRandom) Token(n int) (string, error) { return util.RandomToken(n) }
+
+func (cryptoRandom) Digits(n int) (string, error) { return util.RandomDigits(n) }
+
+func (cryptoRandom) UUID() string { return uuid.NewString() }
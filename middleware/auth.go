@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/SawitProRecruitment/UserService/shared/revocation"
 	"github.com/SawitProRecruitment/UserService/shared/util"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -10,7 +11,9 @@ import (
 	"strings"
 )
 
-func Auth(blacklistedUrl ...string) echo.MiddlewareFunc {
+// Auth parses the bearer token of every request except the blacklisted ones
+// and rejects tokens found in the revocation store, when one is given.
+func Auth(signer jwt.Signer, revoked revocation.Store, blacklistedUrl ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 
@@ -23,14 +26,30 @@ func Auth(blacklistedUrl ...string) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusBadRequest, "invalid header type, should be bearer")
 			}
 
-			claims, err := jwt.GetSigner().ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "))
+			claims, err := signer.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "))
 			if err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 			}
 
 			ctx := c.Request().Context()
+			if revoked != nil {
+				isRevoked, err := revoked.IsRevoked(ctx, claims)
+				if err != nil {
+					return err
+				}
+				if isRevoked {
+					return echo.NewHTTPError(http.StatusUnauthorized, "token has been revoked")
+				}
+			}
+
+			// a client token has no user, so endpoints that act on the logged
+			// in user reject it as not logged in
 			ctx = context.WithValue(ctx, "Claims", claims)
-			ctx = context.WithValue(ctx, "UserID", claims.UserId)
+			if claims.IsClient() {
+				ctx = context.WithValue(ctx, "ClientID", claims.ClientId)
+			} else {
+				ctx = context.WithValue(ctx, "UserID", claims.UserId)
+			}
 			c.SetRequest(c.Request().WithContext(ctx))
 
 			return next(c)
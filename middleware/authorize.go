@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/SawitProRecruitment/UserService/shared/util"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// permissionsExtension is the extension of an operation in api.yml listing
+// the permissions a request needs, e.g. x-permissions: [users:unlock].
+const permissionsExtension = "x-permissions"
+
+// RoutePermissions maps the method and path of a route, as in
+// "POST:/v1/admin/users/:id/unlock", to the permissions it requires.
+type RoutePermissions map[string][]string
+
+// PermissionsFromSpec reads the permissions every operation of the spec
+// requires.
+func PermissionsFromSpec(spec *openapi3.T) (RoutePermissions, error) {
+	permissions := RoutePermissions{}
+
+	for path, item := range spec.Paths.Map() {
+		for method, operation := range item.Operations() {
+			value, ok := operation.Extensions[permissionsExtension]
+			if !ok {
+				continue
+			}
+
+			values, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s of %s %s must be a list", permissionsExtension, method, path)
+			}
+
+			route := method + ":" + echoPath(path)
+			for _, value := range values {
+				permission, ok := value.(string)
+				if !ok || permission == "" {
+					return nil, fmt.Errorf("%s of %s %s must only hold names", permissionsExtension, method, path)
+				}
+				permissions[route] = append(permissions[route], permission)
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+// Unprotected returns the routes of the spec under the path prefix, e.g.
+// "/v1/admin/", that require no permission. Authorize lets such a route
+// through for every token, so one added without x-permissions must be caught
+// before the server starts.
+func (p RoutePermissions) Unprotected(spec *openapi3.T, prefix string) []string {
+	var routes []string
+	for path, item := range spec.Paths.Map() {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		for method := range item.Operations() {
+			route := method + ":" + echoPath(path)
+			if len(p[route]) == 0 {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	sort.Strings(routes)
+	return routes
+}
+
+// echoPath converts the parameters of an OpenAPI path, e.g. {id}, to the
+// ones of an echo route, e.g. :id.
+func echoPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Authorize rejects requests whose token is not granted every permission the
+// route requires. A user is granted the permissions of its roles, a client
+// its scopes. It must run after Auth, which puts the claims in the context.
+func Authorize(permissions RoutePermissions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			required := permissions[c.Request().Method+":"+c.Path()]
+			if len(required) == 0 {
+				return next(c)
+			}
+
+			claims, err := util.GetClaimsFromContext(c.Request().Context())
+			if err != nil {
+				return err
+			}
+
+			for _, permission := range required {
+				if !claims.HasScope(permission) {
+					return echo.NewHTTPError(http.StatusForbidden, "missing permission "+permission)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RestrictDelegated rejects tokens a user granted to an OAuth client on every
+// route except the allowed ones, e.g. "GET:/v1/oauth/userinfo", so a client
+// can not act as the user on this service. It must run after Auth.
+func RestrictDelegated(allowed ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := util.GetClaimsFromContext(c.Request().Context())
+			if err != nil || !claims.IsDelegated() {
+				return next(c)
+			}
+
+			if !util.In(c.Request().Method+":"+c.Path(), allowed...) {
+				return echo.NewHTTPError(http.StatusForbidden, "token of a client can not be used here")
+			}
+
+			return next(c)
+		}
+	}
+}
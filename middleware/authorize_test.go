@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serve routes the request through the middleware as Auth would have left
+// it, with the claims of the token in the context.
+func serve(middleware echo.MiddlewareFunc, claims *jwt.Claims, method, route, target string) int {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if claims != nil {
+				c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), "Claims", claims)))
+			}
+			return next(c)
+		}
+	})
+	e.Use(middleware)
+	e.Add(method, route, func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w.Code
+}
+
+const testSpec = `
+openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /v1/admin/users:
+    get:
+      x-permissions: [users:read]
+      responses:
+        '200':
+          description: OK
+  /v1/admin/users/{id}/unlock:
+    post:
+      x-permissions: [users:read, users:unlock]
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '204':
+          description: No Content
+    delete:
+      responses:
+        '204':
+          description: No Content
+  /v1/users/profile:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+func loadTestSpec(t *testing.T) *openapi3.T {
+	spec, err := openapi3.NewLoader().LoadFromData([]byte(testSpec))
+	assert.NoError(t, err)
+	return spec
+}
+
+func TestPermissionsFromSpec(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		permissions, err := PermissionsFromSpec(loadTestSpec(t))
+		assert.NoError(t, err)
+		assert.Equal(t, RoutePermissions{
+			"GET:/v1/admin/users":             {"users:read"},
+			"POST:/v1/admin/users/:id/unlock": {"users:read", "users:unlock"},
+		}, permissions)
+	})
+
+	t.Run("Failed Not A List", func(t *testing.T) {
+		spec := loadTestSpec(t)
+		spec.Paths.Find("/v1/admin/users").Get.Extensions[permissionsExtension] = "users:read"
+
+		_, err := PermissionsFromSpec(spec)
+		assert.Error(t, err)
+	})
+}
+
+func TestRoutePermissions_Unprotected(t *testing.T) {
+	spec := loadTestSpec(t)
+	permissions, err := PermissionsFromSpec(spec)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"DELETE:/v1/admin/users/:id/unlock"}, permissions.Unprotected(spec, "/v1/admin/"))
+}
+
+func TestAuthorize(t *testing.T) {
+	authorize := Authorize(RoutePermissions{"POST:/v1/admin/users/:id/unlock": {"users:read", "users:unlock"}})
+
+	t.Run("Success Granted", func(t *testing.T) {
+		claims := &jwt.Claims{UserId: 1, Scope: "users:read users:unlock"}
+		code := serve(authorize, claims, http.MethodPost, "/v1/admin/users/:id/unlock", "/v1/admin/users/7/unlock")
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Success Route Without Permissions", func(t *testing.T) {
+		code := serve(authorize, &jwt.Claims{UserId: 1}, http.MethodGet, "/v1/users/profile", "/v1/users/profile")
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Failed Missing Permission", func(t *testing.T) {
+		claims := &jwt.Claims{UserId: 1, Scope: "users:read"}
+		code := serve(authorize, claims, http.MethodPost, "/v1/admin/users/:id/unlock", "/v1/admin/users/7/unlock")
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Failed Without Token", func(t *testing.T) {
+		code := serve(authorize, nil, http.MethodPost, "/v1/admin/users/:id/unlock", "/v1/admin/users/7/unlock")
+		assert.NotEqual(t, http.StatusNoContent, code)
+	})
+}
+
+func TestRestrictDelegated(t *testing.T) {
+	var (
+		restrict  = RestrictDelegated("GET:/v1/oauth/userinfo")
+		delegated = &jwt.Claims{UserId: 1, AuthorizedParty: "dashboard", Scope: "openid"}
+	)
+
+	t.Run("Success Allowed Route", func(t *testing.T) {
+		code := serve(restrict, delegated, http.MethodGet, "/v1/oauth/userinfo", "/v1/oauth/userinfo")
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Success Token Of User", func(t *testing.T) {
+		code := serve(restrict, &jwt.Claims{UserId: 1}, http.MethodPut, "/v1/users/profile", "/v1/users/profile")
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Success Without Token", func(t *testing.T) {
+		code := serve(restrict, nil, http.MethodPost, "/v1/users/login", "/v1/users/login")
+		assert.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Failed Other Route", func(t *testing.T) {
+		code := serve(restrict, delegated, http.MethodPut, "/v1/users/profile", "/v1/users/profile")
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+}
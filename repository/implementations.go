@@ -2,12 +2,16 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/SawitProRecruitment/UserService/shared/util"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func (r *Repository) CreateUser(ctx context.Context, input CreateUserInput) (output CreateUserOutput, err error) {
@@ -57,14 +61,23 @@ func (r *Repository) UpdateUser(ctx context.Context, name, phoneNumber *string,
 	return
 }
 
+// userColumns are the columns of users that scanUser reads, in its order.
+const userColumns = "id, name, phone_number, password, salt, successful_login_count, failed_login_count, " +
+	"last_login_at, last_failed_login_at, locked_until, phone_verified_at, deactivated_at, created_at"
+
+func scanUser(row interface{ Scan(dest ...any) error }, user *User) error {
+	return row.Scan(&user.Id, &user.FullName, &user.PhoneNumber, &user.Password, &user.Salt,
+		&user.SuccessfulLoginCount, &user.FailedLoginCount, &user.LastLoginAt, &user.LastFailedLoginAt,
+		&user.LockedUntil, &user.PhoneVerifiedAt, &user.DeactivatedAt, &user.CreatedAt)
+}
+
 func (r *Repository) FindUserByPhoneNumber(ctx context.Context, phoneNumber string) (output User, err error) {
 	var (
-		query = "SELECT id, name, phone_number, password, salt FROM users WHERE phone_number = $1"
+		query = "SELECT " + userColumns + " FROM users WHERE phone_number = $1"
 		args  = []any{phoneNumber}
 	)
 
-	err = r.Db.QueryRowContext(ctx, query, args...).
-		Scan(&output.Id, &output.FullName, &output.PhoneNumber, &output.Password, &output.Salt)
+	err = scanUser(r.Db.QueryRowContext(ctx, query, args...), &output)
 	if err != nil {
 		err = util.TransformError(err)
 		return
@@ -73,21 +86,1356 @@ func (r *Repository) FindUserByPhoneNumber(ctx context.Context, phoneNumber stri
 	return
 }
 
+// FindUserById returns a 404 HTTPError when there is no user with the id.
 func (r *Repository) FindUserById(ctx context.Context, id int64) (output User, err error) {
 	var (
-		query = "SELECT id, name, phone_number, password, salt FROM users WHERE id = $1"
+		query = "SELECT " + userColumns + " FROM users WHERE id = $1"
 		args  = []any{id}
 	)
 
+	err = scanUser(r.Db.QueryRowContext(ctx, query, args...), &output)
+	if errors.Is(err, sql.ErrNoRows) {
+		return output, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	return
+}
+
+func (r *Repository) IncrementSuccessfulLogin(ctx context.Context, id int64) (err error) {
+	var (
+		query = "UPDATE users SET successful_login_count = successful_login_count + 1, last_login_at = now(), " +
+			"failed_attempts_in_window = 0, failed_window_started_at = NULL, lockout_count = 0, locked_until = NULL " +
+			"WHERE id = $1"
+		args = []any{id}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// IncrementFailedLogin records a failed login and applies the lockout policy,
+// returning the time the account is locked until when this failure locks it.
+func (r *Repository) IncrementFailedLogin(ctx context.Context, id int64) (lockedUntil *time.Time, err error) {
+	var (
+		selectQuery = "SELECT failed_attempts_in_window, failed_window_started_at, lockout_count FROM users " +
+			"WHERE id = $1 FOR UPDATE"
+		updateQuery = "UPDATE users SET failed_login_count = failed_login_count + 1, last_failed_login_at = $2, " +
+			"failed_attempts_in_window = $3, failed_window_started_at = $4, lockout_count = $5, locked_until = $6 " +
+			"WHERE id = $1"
+
+		state failedLogins
+		now   = time.Now()
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, selectQuery, id).Scan(&state.attemptsInWindow, &state.windowStartedAt,
+		&state.lockoutCount)
+	if err != nil {
+		return
+	}
+
+	state, lockedUntil = r.LockoutPolicy.recordFailure(state, now)
+
+	_, err = tx.ExecContext(ctx, updateQuery, id, now, state.attemptsInWindow, state.windowStartedAt,
+		state.lockoutCount, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// UnlockUser clears the lockout of the user and records it in the audit log.
+func (r *Repository) UnlockUser(ctx context.Context, id int64, audit CreateAuditLogInput) (err error) {
+	var (
+		query = "UPDATE users SET failed_attempts_in_window = 0, failed_window_started_at = NULL, lockout_count = 0, " +
+			"locked_until = NULL WHERE id = $1"
+		args = []any{id}
+	)
+
+	return r.audited(ctx, audit, func(tx *sql.Tx, _ *CreateAuditLogInput) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return userAffected(result)
+	})
+}
+
+func (r *Repository) CreateRefreshToken(ctx context.Context, input CreateRefreshTokenInput) (err error) {
+	var (
+		query = "INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)"
+		args  = []any{input.UserId, input.FamilyId, input.TokenHash, input.ExpiresAt}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (output RefreshToken, err error) {
+	var (
+		query = "SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at FROM refresh_tokens " +
+			"WHERE token_hash = $1"
+		args = []any{tokenHash}
+	)
+
 	err = r.Db.QueryRowContext(ctx, query, args...).
-		Scan(&output.Id, &output.FullName, &output.PhoneNumber, &output.Password, &output.Salt)
+		Scan(&output.Id, &output.UserId, &output.FamilyId, &output.TokenHash, &output.ExpiresAt, &output.UsedAt,
+			&output.RevokedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+// MarkRefreshTokenUsed marks the token as used, reporting false when it was
+// already used so that concurrent refreshes with the same token are detected.
+func (r *Repository) MarkRefreshTokenUsed(ctx context.Context, id int64) (marked bool, err error) {
+	var (
+		query = "UPDATE refresh_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL"
+		args  = []any{id}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return
 	}
 
-	if output.Id == 0 {
-		return output, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes the session and every refresh token that
+// was issued for it.
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) (err error) {
+	var (
+		sessionQuery = "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL"
+		tokenQuery   = "UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL"
+		args         = []any{familyId}
+	)
+
+	return r.execInTx(ctx, []string{sessionQuery, tokenQuery}, args)
+}
+
+// RevokeUserRefreshTokens revokes every session of the user together with
+// their refresh tokens, returning the ids of the sessions that were revoked.
+func (r *Repository) RevokeUserRefreshTokens(ctx context.Context, userId int64) (revokedIds []string, err error) {
+	var (
+		sessionQuery = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL RETURNING id"
+		tokenQuery   = "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+		args         = []any{userId}
+	)
+
+	return r.revokeSessions(ctx, sessionQuery, tokenQuery, args)
+}
+
+func (r *Repository) CreateSession(ctx context.Context, input CreateSessionInput) (err error) {
+	var (
+		query = "INSERT INTO sessions (id, user_id, user_agent, ip_address, device_label, client_id, scope) " +
+			"VALUES ($1, $2, $3, $4, $5, $6, $7)"
+		args = []any{input.Id, input.UserId, input.UserAgent, input.IpAddress, input.DeviceLabel, input.ClientId,
+			input.Scope}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) TouchSession(ctx context.Context, id string) (err error) {
+	var (
+		query = "UPDATE sessions SET last_seen_at = now() WHERE id = $1"
+		args  = []any{id}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ListActiveSessions lists the sessions of the user that can still be
+// refreshed. A session nobody refreshed until its last refresh token expired
+// has ended, even though it was never revoked.
+func (r *Repository) ListActiveSessions(ctx context.Context, userId int64) (output []Session, err error) {
+	var (
+		query = "SELECT id, user_id, user_agent, ip_address, device_label, client_id, scope, created_at, last_seen_at " +
+			"FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND EXISTS (SELECT 1 FROM refresh_tokens " +
+			"WHERE family_id = sessions.id AND used_at IS NULL AND revoked_at IS NULL AND expires_at > now()) " +
+			"ORDER BY last_seen_at DESC"
+		args = []any{userId}
+	)
+
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(&session.Id, &session.UserId, &session.UserAgent, &session.IpAddress, &session.DeviceLabel,
+			&session.ClientId, &session.Scope, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, session)
+	}
+
+	return output, rows.Err()
+}
+
+func (r *Repository) RevokeSession(ctx context.Context, userId int64, id string) (err error) {
+	var (
+		sessionQuery = "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+		tokenQuery   = "UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sessionQuery, id, userId)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "session not found")
+	}
+
+	_, err = tx.ExecContext(ctx, tokenQuery, id)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// RevokeOtherSessions revokes every session of the user except currentId,
+// returning the ids of the sessions that were revoked.
+func (r *Repository) RevokeOtherSessions(ctx context.Context, userId int64, currentId string) (revokedIds []string, err error) {
+	var (
+		sessionQuery = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL " +
+			"RETURNING id"
+		tokenQuery = "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND family_id <> $2 " +
+			"AND revoked_at IS NULL"
+		args = []any{userId, currentId}
+	)
+
+	return r.revokeSessions(ctx, sessionQuery, tokenQuery, args)
+}
+
+// revokeSessions runs sessionQuery, which revokes sessions and returns their
+// ids, and tokenQuery, which revokes their refresh tokens, in one transaction.
+func (r *Repository) revokeSessions(ctx context.Context, sessionQuery, tokenQuery string, args []any) (revokedIds []string, err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, sessionQuery, args...)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		revokedIds = append(revokedIds, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, tokenQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return revokedIds, tx.Commit()
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, id int64, password, salt string) (err error) {
+	var (
+		query = "UPDATE users SET password = $1, salt = $2, updated_at = now() WHERE id = $3"
+		args  = []any{password, salt, id}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// CreatePasswordResetCode stores a new reset code, invalidating the codes
+// that were previously sent to the user.
+func (r *Repository) CreatePasswordResetCode(ctx context.Context, input CreatePasswordResetCodeInput) (err error) {
+	var (
+		invalidateQuery = "UPDATE password_reset_codes SET consumed_at = now() WHERE user_id = $1 AND consumed_at IS NULL"
+		insertQuery     = "INSERT INTO password_reset_codes (user_id, code_hash, expires_at) VALUES ($1, $2, $3)"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, invalidateQuery, input.UserId)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, input.UserId, input.CodeHash, input.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) FindActivePasswordResetCode(ctx context.Context, userId int64) (output PasswordResetCode, err error) {
+	var (
+		query = "SELECT id, user_id, code_hash, attempts, expires_at, created_at FROM password_reset_codes " +
+			"WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > now() ORDER BY created_at DESC LIMIT 1"
+		args = []any{userId}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.Id, &output.UserId, &output.CodeHash, &output.Attempts, &output.ExpiresAt, &output.CreatedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementPasswordResetAttempts(ctx context.Context, id int64) (attempts int, err error) {
+	var (
+		query = "UPDATE password_reset_codes SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts"
+		args  = []any{id}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&attempts)
+	if err != nil {
+		return
 	}
 
 	return
 }
+
+func (r *Repository) ConsumePasswordResetCode(ctx context.Context, id int64) (consumed bool, err error) {
+	var (
+		query = "UPDATE password_reset_codes SET consumed_at = now() WHERE id = $1 AND consumed_at IS NULL"
+		args  = []any{id}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+// CreatePhoneVerification stores a new verification code, invalidating the
+// codes that were previously sent for the user.
+func (r *Repository) CreatePhoneVerification(ctx context.Context, input CreatePhoneVerificationInput) (err error) {
+	var (
+		invalidateQuery = "UPDATE phone_verifications SET consumed_at = now() WHERE user_id = $1 AND consumed_at IS NULL"
+		insertQuery     = "INSERT INTO phone_verifications (user_id, phone_number, code_hash, expires_at) " +
+			"VALUES ($1, $2, $3, $4)"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, invalidateQuery, input.UserId)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) FindActivePhoneVerification(ctx context.Context, userId int64) (output PhoneVerification, err error) {
+	var (
+		query = "SELECT id, user_id, phone_number, code_hash, attempts, expires_at, created_at FROM phone_verifications " +
+			"WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > now() ORDER BY created_at DESC LIMIT 1"
+		args = []any{userId}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.Id, &output.UserId, &output.PhoneNumber, &output.CodeHash, &output.Attempts,
+			&output.ExpiresAt, &output.CreatedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+// CountPhoneVerificationsSince counts the verification codes sent for the
+// user since the given time, consumed or not, for rate limiting.
+func (r *Repository) CountPhoneVerificationsSince(ctx context.Context, userId int64, since time.Time) (count int, err error) {
+	var (
+		query = "SELECT count(*) FROM phone_verifications WHERE user_id = $1 AND created_at >= $2"
+		args  = []any{userId, since}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementPhoneVerificationAttempts(ctx context.Context, id int64) (attempts int, err error) {
+	var (
+		query = "UPDATE phone_verifications SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts"
+		args  = []any{id}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&attempts)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ConfirmPhoneVerification consumes the verification and makes its phone
+// number the verified phone number of the user, in a single transaction.
+func (r *Repository) ConfirmPhoneVerification(ctx context.Context, id int64) (confirmed bool, err error) {
+	var (
+		consumeQuery = "UPDATE phone_verifications SET consumed_at = now() " +
+			"WHERE id = $1 AND consumed_at IS NULL AND expires_at > now() RETURNING user_id, phone_number"
+		updateQuery = "UPDATE users SET phone_number = $1, phone_verified_at = now(), updated_at = now() WHERE id = $2"
+		userId      int64
+		phoneNumber string
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// an already consumed or expired verification has no rows to scan, which
+	// is reported as not confirmed rather than as an error
+	err = tx.QueryRowContext(ctx, consumeQuery, id).Scan(&userId, &phoneNumber)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	// the phone number may have been taken since the code was sent, which
+	// fails on the unique constraint and is reported as a conflict
+	_, err = tx.ExecContext(ctx, updateQuery, phoneNumber, userId)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return true, tx.Commit()
+}
+
+// CreateLoginOTP stores a new login code, invalidating the codes that were
+// previously sent to the phone number.
+func (r *Repository) CreateLoginOTP(ctx context.Context, input CreateLoginOTPInput) (err error) {
+	var (
+		invalidateQuery = "UPDATE login_otps SET consumed_at = now() WHERE phone_number = $1 AND consumed_at IS NULL"
+		insertQuery     = "INSERT INTO login_otps (user_id, phone_number, code_hash, expires_at) VALUES ($1, $2, $3, $4)"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, invalidateQuery, input.PhoneNumber)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) FindActiveLoginOTP(ctx context.Context, phoneNumber string) (output LoginOTP, err error) {
+	var (
+		query = "SELECT id, user_id, phone_number, code_hash, attempts, expires_at, created_at FROM login_otps " +
+			"WHERE phone_number = $1 AND consumed_at IS NULL AND expires_at > now() ORDER BY created_at DESC LIMIT 1"
+		args = []any{phoneNumber}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.Id, &output.UserId, &output.PhoneNumber, &output.CodeHash, &output.Attempts,
+			&output.ExpiresAt, &output.CreatedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+// CountLoginOTPsSince counts the login codes sent to the phone number since
+// the given time, consumed or not, for rate limiting.
+func (r *Repository) CountLoginOTPsSince(ctx context.Context, phoneNumber string, since time.Time) (count int, err error) {
+	var (
+		query = "SELECT count(*) FROM login_otps WHERE phone_number = $1 AND created_at >= $2"
+		args  = []any{phoneNumber, since}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementLoginOTPAttempts(ctx context.Context, id int64) (attempts int, err error) {
+	var (
+		query = "UPDATE login_otps SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts"
+		args  = []any{id}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&attempts)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) ConsumeLoginOTP(ctx context.Context, id int64) (consumed bool, err error) {
+	var (
+		query = "UPDATE login_otps SET consumed_at = now() WHERE id = $1 AND consumed_at IS NULL"
+		args  = []any{id}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+// SaveTOTPSecret stores the secret of an authenticator app that is being
+// enrolled, replacing a previous unconfirmed one. Nothing is saved when two
+// factor authentication is already enabled.
+func (r *Repository) SaveTOTPSecret(ctx context.Context, userId int64, secret string) (saved bool, err error) {
+	var (
+		query = "INSERT INTO user_totp_secrets (user_id, secret) VALUES ($1, $2) " +
+			"ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now() " +
+			"WHERE user_totp_secrets.confirmed_at IS NULL"
+		args = []any{userId, secret}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+func (r *Repository) FindTOTP(ctx context.Context, userId int64) (output TOTP, err error) {
+	var (
+		query = "SELECT user_id, secret, last_used_step, confirmed_at FROM user_totp_secrets WHERE user_id = $1"
+		args  = []any{userId}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.UserId, &output.Secret, &output.LastUsedStep, &output.ConfirmedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+// ConfirmTOTP enables two-factor authentication, step is the time step of the
+// code used to confirm it, which can not be used again.
+func (r *Repository) ConfirmTOTP(ctx context.Context, userId int64, step int64) (err error) {
+	var (
+		query = "UPDATE user_totp_secrets SET confirmed_at = now(), last_used_step = $2 " +
+			"WHERE user_id = $1 AND confirmed_at IS NULL"
+		args = []any{userId, step}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// UseTOTPStep records the time step of a code as used, it is not used when a
+// code of the same or a later step was used before, i.e. the code is replayed.
+func (r *Repository) UseTOTPStep(ctx context.Context, userId int64, step int64) (used bool, err error) {
+	var (
+		query = "UPDATE user_totp_secrets SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+		args  = []any{userId, step}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+// DeleteTOTP removes the authenticator app together with the recovery codes
+// of the user.
+func (r *Repository) DeleteTOTP(ctx context.Context, userId int64) (err error) {
+	var (
+		recoveryCodesQuery = "DELETE FROM mfa_recovery_codes WHERE user_id = $1"
+		totpQuery          = "DELETE FROM user_totp_secrets WHERE user_id = $1"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, recoveryCodesQuery, userId)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, totpQuery, userId)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) CreateMFAChallenge(ctx context.Context, input CreateMFAChallengeInput) (err error) {
+	var (
+		query = "INSERT INTO mfa_challenges (user_id, token_hash, device_label, expires_at) VALUES ($1, $2, $3, $4)"
+		args  = []any{input.UserId, input.TokenHash, input.DeviceLabel, input.ExpiresAt}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) FindActiveMFAChallenge(ctx context.Context, tokenHash string) (output MFAChallenge, err error) {
+	var (
+		query = "SELECT id, user_id, token_hash, device_label, attempts, expires_at FROM mfa_challenges " +
+			"WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > now()"
+		args = []any{tokenHash}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.Id, &output.UserId, &output.TokenHash, &output.DeviceLabel, &output.Attempts, &output.ExpiresAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementMFAChallengeAttempts(ctx context.Context, id int64) (attempts int, err error) {
+	var (
+		query = "UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts"
+		args  = []any{id}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&attempts)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (r *Repository) ConsumeMFAChallenge(ctx context.Context, id int64) (consumed bool, err error) {
+	var (
+		query = "UPDATE mfa_challenges SET consumed_at = now() WHERE id = $1 AND consumed_at IS NULL"
+		args  = []any{id}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+// execInTx runs every query with the same arguments in a single transaction.
+func (r *Repository) execInTx(ctx context.Context, queries []string, args []any) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes stores a new set of recovery codes, invalidating every
+// code the user had before.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) (err error) {
+	var (
+		deleteQuery = "DELETE FROM mfa_recovery_codes WHERE user_id = $1"
+		insertQuery = "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, deleteQuery, userId)
+	if err != nil {
+		return
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.ExecContext(ctx, insertQuery, userId, codeHash)
+		if err != nil {
+			return
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the code as used, reporting false for an unknown or
+// already used code.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (used bool, err error) {
+	var (
+		query = "UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+		args  = []any{userId, codeHash}
+	)
+
+	result, err := r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected == 1, nil
+}
+
+func (r *Repository) CreateAuditLog(ctx context.Context, input CreateAuditLogInput) (err error) {
+	return insertAuditLog(ctx, r.Db, input)
+}
+
+// execer runs a statement on the database or within a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertAuditLog(ctx context.Context, db execer, input CreateAuditLogInput) (err error) {
+	var (
+		query = "INSERT INTO audit_logs (actor_id, user_id, action, ip_address, user_agent, details) " +
+			"VALUES ($1, $2, $3, $4, $5, $6)"
+		details = []byte("{}")
+	)
+
+	if len(input.Details) > 0 {
+		details, err = json.Marshal(input.Details)
+		if err != nil {
+			return
+		}
+	}
+
+	args := []any{input.ActorId, input.UserId, input.Action, input.IpAddress, input.UserAgent, string(details)}
+	_, err = db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// audited runs the change and records it in the audit log in a single
+// transaction, so that neither is stored without the other. The change may
+// complete the audit log entry, e.g. with the id of a created user.
+func (r *Repository) audited(ctx context.Context, audit CreateAuditLogInput,
+	change func(tx *sql.Tx, audit *CreateAuditLogInput) error) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = change(tx, &audit)
+	if err != nil {
+		return
+	}
+
+	err = insertAuditLog(ctx, tx, audit)
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) FindOAuthClient(ctx context.Context, clientId string) (output OAuthClient, err error) {
+	var (
+		query        = "SELECT client_id, secret_hash, scopes, redirect_uris FROM oauth_clients WHERE client_id = $1"
+		args         = []any{clientId}
+		scopes       string
+		redirectURIs string
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).Scan(&output.ClientId, &output.SecretHash, &scopes, &redirectURIs)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	output.Scopes = strings.Fields(scopes)
+	output.RedirectURIs = strings.Fields(redirectURIs)
+	return
+}
+
+// FindSession returns the session with the given id unless it is revoked.
+func (r *Repository) FindSession(ctx context.Context, id string) (output Session, err error) {
+	var (
+		query = "SELECT id, user_id, user_agent, ip_address, device_label, client_id, scope, created_at, last_seen_at " +
+			"FROM sessions WHERE id = $1 AND revoked_at IS NULL"
+		args = []any{id}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.Id, &output.UserId, &output.UserAgent, &output.IpAddress, &output.DeviceLabel,
+			&output.ClientId, &output.Scope, &output.CreatedAt, &output.LastSeenAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+func (r *Repository) CreateAuthorizationCode(ctx context.Context, input CreateAuthorizationCodeInput) (err error) {
+	var (
+		query = "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, " +
+			"code_challenge, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+		args = []any{input.CodeHash, input.ClientId, input.UserId, input.RedirectURI, input.Scope, input.Nonce,
+			input.CodeChallenge, input.ExpiresAt}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ConsumeAuthorizationCode marks the code as used and returns it, or the zero
+// value when the code is unknown, expired or was used before. Marking and
+// reading in one statement keeps concurrent requests from both using it.
+func (r *Repository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (output AuthorizationCode, err error) {
+	var (
+		query = "UPDATE oauth_authorization_codes SET consumed_at = now() " +
+			"WHERE code_hash = $1 AND consumed_at IS NULL AND expires_at > now() " +
+			"RETURNING client_id, user_id, redirect_uri, scope, nonce, code_challenge, created_at"
+		args = []any{codeHash}
+	)
+
+	err = r.Db.QueryRowContext(ctx, query, args...).
+		Scan(&output.ClientId, &output.UserId, &output.RedirectURI, &output.Scope, &output.Nonce,
+			&output.CodeChallenge, &output.CreatedAt)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+
+	return
+}
+
+// FindUserRoles returns the roles of the user ordered by name, each with the
+// permissions it grants.
+func (r *Repository) FindUserRoles(ctx context.Context, userId int64) (output []Role, err error) {
+	var (
+		query = "SELECT roles.name, COALESCE(permissions.name, '') FROM user_roles " +
+			"JOIN roles ON roles.id = user_roles.role_id " +
+			"LEFT JOIN role_permissions ON role_permissions.role_id = roles.id " +
+			"LEFT JOIN permissions ON permissions.id = role_permissions.permission_id " +
+			"WHERE user_roles.user_id = $1 ORDER BY roles.name, permissions.name"
+		args = []any{userId}
+	)
+
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role, permission string
+		err = rows.Scan(&role, &permission)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(output) == 0 || output[len(output)-1].Name != role {
+			output = append(output, Role{Name: role})
+		}
+		if permission != "" {
+			output[len(output)-1].Permissions = append(output[len(output)-1].Permissions, permission)
+		}
+	}
+
+	return output, rows.Err()
+}
+
+// AssignRole gives the user the role, which it may already have.
+func (r *Repository) AssignRole(ctx context.Context, userId int64, role string) (err error) {
+	var (
+		findQuery   = "SELECT id FROM roles WHERE name = $1"
+		insertQuery = "INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		roleId      int64
+	)
+
+	err = r.Db.QueryRowContext(ctx, findQuery, role).Scan(&roleId)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+	if roleId == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "role not found")
+	}
+
+	_, err = r.Db.ExecContext(ctx, insertQuery, userId, roleId)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// BootstrapRole gives the users the role unless anyone has it already, so
+// the first holders of a role can be configured without overriding later
+// changes.
+func (r *Repository) BootstrapRole(ctx context.Context, role string, userIds []int64) (assigned bool, err error) {
+	var (
+		findQuery = "SELECT id, EXISTS (SELECT 1 FROM user_roles WHERE role_id = roles.id) FROM roles " +
+			"WHERE name = $1 FOR UPDATE"
+		insertQuery = "INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		roleId      int64
+		taken       bool
+	)
+
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// the row of the role is locked, so instances starting at the same time
+	// do not both assign it
+	err = tx.QueryRowContext(ctx, findQuery, role).Scan(&roleId, &taken)
+	if err != nil {
+		err = util.TransformError(err)
+		return
+	}
+	if roleId == 0 {
+		return false, echo.NewHTTPError(http.StatusNotFound, "role not found")
+	}
+	if taken {
+		return false, nil
+	}
+
+	for _, userId := range userIds {
+		_, err = tx.ExecContext(ctx, insertQuery, userId, roleId)
+		if err != nil {
+			return
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *Repository) RevokeRole(ctx context.Context, userId int64, role string) (err error) {
+	var (
+		query = "DELETE FROM user_roles USING roles " +
+			"WHERE user_roles.role_id = roles.id AND user_roles.user_id = $1 AND roles.name = $2"
+		args = []any{userId, role}
+	)
+
+	_, err = r.Db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// userSortColumns are the columns ListUsers sorts by. Only these constants
+// end up in the query, never the requested value itself.
+var userSortColumns = map[string]struct {
+	column string
+	// cast converts the value of a UserKey to the type of the column.
+	cast string
+	// unique columns need no id to order users with the same value.
+	unique bool
+}{
+	UserSortId:          {column: "id", unique: true},
+	UserSortCreatedAt:   {column: "created_at", cast: "::timestamptz"},
+	UserSortName:        {column: "name"},
+	UserSortPhoneNumber: {column: "phone_number", unique: true},
+}
+
+// ListUsers returns a page of the users matching the filters of the input. It
+// pages by the key of the last user rather than an offset, so every page is
+// read from the (column, id) indexes of users without skipping rows.
+func (r *Repository) ListUsers(ctx context.Context, input ListUsersInput) (output []User, err error) {
+	var (
+		builder queryBuilder
+		order   = "ASC"
+		after   = ">"
+	)
+
+	sort, ok := userSortColumns[input.SortBy]
+	if input.SortBy == "" {
+		sort, ok = userSortColumns[UserSortId], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort column %q", input.SortBy)
+	}
+	if input.Descending {
+		order, after = "DESC", "<"
+	}
+
+	if input.Name != "" {
+		builder.where("name ILIKE ?", "%"+escapeLike(input.Name)+"%")
+	}
+	if input.PhoneNumber != "" {
+		builder.where("phone_number LIKE ?", escapeLike(input.PhoneNumber)+"%")
+	}
+	if input.CreatedFrom != nil {
+		builder.where("created_at >= ?", *input.CreatedFrom)
+	}
+	if input.CreatedTo != nil {
+		builder.where("created_at < ?", *input.CreatedTo)
+	}
+	switch input.Status {
+	case UserStatusActive:
+		builder.where("deactivated_at IS NULL AND (locked_until IS NULL OR locked_until <= now())")
+	case UserStatusLocked:
+		builder.where("deactivated_at IS NULL AND locked_until > now()")
+	case UserStatusDeactivated:
+		builder.where("deactivated_at IS NOT NULL")
+	}
+
+	if input.After != nil {
+		switch {
+		case sort.column == "id":
+			builder.where("id "+after+" ?", input.After.Id)
+		case sort.unique:
+			builder.where(sort.column+" "+after+" ?"+sort.cast, input.After.Value)
+		default:
+			builder.where("("+sort.column+", id) "+after+" (?"+sort.cast+", ?)", input.After.Value, input.After.Id)
+		}
+	}
+
+	orderBy := sort.column + " " + order
+	if !sort.unique {
+		orderBy += ", id " + order
+	}
+
+	query, args := builder.build("SELECT "+userColumns+" FROM users", "ORDER BY "+orderBy+" LIMIT ?", input.Limit)
+
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err = scanUser(rows, &user)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, user)
+	}
+
+	return output, rows.Err()
+}
+
+// queryBuilder joins the conditions of a query whose values are passed as
+// arguments. The SQL of the conditions must only be made of constants, the
+// values are given by ? placeholders.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+func (b *queryBuilder) where(condition string, args ...any) {
+	b.conditions = append(b.conditions, condition)
+	b.args = append(b.args, args...)
+}
+
+// build returns the query of the conditions between the head and the tail,
+// numbering the placeholders for Postgres, with the arguments in order.
+func (b *queryBuilder) build(head, tail string, tailArgs ...any) (string, []any) {
+	query := head
+	if len(b.conditions) > 0 {
+		query += " WHERE " + strings.Join(b.conditions, " AND ")
+	}
+	query += " " + tail
+
+	return sqlx.Rebind(sqlx.DOLLAR, query), append(b.args, tailArgs...)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so the value only
+// matches itself.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// CreateUserAccount creates a user on behalf of an admin and records it in
+// the audit log.
+func (r *Repository) CreateUserAccount(ctx context.Context, input CreateUserAccountInput, audit CreateAuditLogInput) (output CreateUserOutput, err error) {
+	var (
+		query = "INSERT INTO users (name, phone_number, password, salt, phone_verified_at) " +
+			"VALUES ($1, $2, $3, $4, CASE WHEN $5::boolean THEN now() END) RETURNING id"
+		args = []any{input.FullName, input.PhoneNumber, input.Password, input.Salt, input.PhoneVerified}
+	)
+
+	err = r.audited(ctx, audit, func(tx *sql.Tx, audit *CreateAuditLogInput) error {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&output.Id)
+		if err != nil {
+			return util.TransformError(err)
+		}
+
+		audit.UserId = output.Id
+		return nil
+	})
+	if err != nil {
+		return CreateUserOutput{}, err
+	}
+
+	return
+}
+
+// UpdateUserAccount changes the user and records it in the audit log.
+func (r *Repository) UpdateUserAccount(ctx context.Context, id int64, input UpdateUserAccountInput, audit CreateAuditLogInput) (err error) {
+	var (
+		query   = "UPDATE users SET %s WHERE id = ?"
+		args    []any
+		setList []string
+	)
+
+	if input.FullName != nil {
+		setList = append(setList, "name = ?")
+		args = append(args, *input.FullName)
+	}
+	if input.PhoneNumber != nil {
+		setList = append(setList, "phone_number = ?")
+		args = append(args, *input.PhoneNumber)
+	}
+	if input.PhoneVerified != nil {
+		if *input.PhoneVerified {
+			setList = append(setList, "phone_verified_at = COALESCE(phone_verified_at, now())")
+		} else {
+			setList = append(setList, "phone_verified_at = NULL")
+		}
+	}
+
+	if len(setList) == 0 {
+		return nil
+	}
+
+	query = fmt.Sprintf(query, strings.Join(setList, ", "))
+	query = sqlx.Rebind(sqlx.DOLLAR, query)
+	args = append(args, id)
+
+	return r.audited(ctx, audit, func(tx *sql.Tx, _ *CreateAuditLogInput) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return util.TransformError(err)
+		}
+
+		return userAffected(result)
+	})
+}
+
+// ResetUserPassword sets the password of the user on behalf of an admin and
+// records it in the audit log. The separate salt is only needed by legacy
+// hashes, so it is cleared.
+func (r *Repository) ResetUserPassword(ctx context.Context, id int64, password string, audit CreateAuditLogInput) (err error) {
+	var (
+		query = "UPDATE users SET password = $1, salt = '', updated_at = now() WHERE id = $2"
+		args  = []any{password, id}
+	)
+
+	return r.audited(ctx, audit, func(tx *sql.Tx, _ *CreateAuditLogInput) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return userAffected(result)
+	})
+}
+
+// LockUser locks the user out until the given time, regardless of failed
+// logins, and records it in the audit log.
+func (r *Repository) LockUser(ctx context.Context, id int64, until time.Time, audit CreateAuditLogInput) (err error) {
+	var (
+		query = "UPDATE users SET locked_until = $2 WHERE id = $1"
+		args  = []any{id, until}
+	)
+
+	return r.audited(ctx, audit, func(tx *sql.Tx, _ *CreateAuditLogInput) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return userAffected(result)
+	})
+}
+
+// DeactivateUser deactivates the user, keeping the time it was first
+// deactivated, and records it in the audit log.
+func (r *Repository) DeactivateUser(ctx context.Context, id int64, audit CreateAuditLogInput) (err error) {
+	var (
+		query = "UPDATE users SET deactivated_at = COALESCE(deactivated_at, now()) WHERE id = $1"
+		args  = []any{id}
+	)
+
+	return r.audited(ctx, audit, func(tx *sql.Tx, _ *CreateAuditLogInput) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return userAffected(result)
+	})
+}
+
+// userAffected reports a user not found when the update of a user by id
+// changed no row.
+func userAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	return nil
+}
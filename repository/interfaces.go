@@ -4,11 +4,68 @@
 // interfaces using mockgen. See the Makefile for more information.
 package repository
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type RepositoryInterface interface {
 	CreateUser(ctx context.Context, input CreateUserInput) (output CreateUserOutput, err error)
 	UpdateUser(ctx context.Context, name, phoneNumber *string, id int64) (err error)
 	FindUserByPhoneNumber(ctx context.Context, phoneNumber string) (output User, err error)
 	FindUserById(ctx context.Context, id int64) (output User, err error)
+	IncrementSuccessfulLogin(ctx context.Context, id int64) (err error)
+	IncrementFailedLogin(ctx context.Context, id int64) (lockedUntil *time.Time, err error)
+	UnlockUser(ctx context.Context, id int64, audit CreateAuditLogInput) (err error)
+	CreateRefreshToken(ctx context.Context, input CreateRefreshTokenInput) (err error)
+	FindRefreshTokenByHash(ctx context.Context, tokenHash string) (output RefreshToken, err error)
+	MarkRefreshTokenUsed(ctx context.Context, id int64) (marked bool, err error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) (err error)
+	RevokeUserRefreshTokens(ctx context.Context, userId int64) (revokedIds []string, err error)
+	CreateSession(ctx context.Context, input CreateSessionInput) (err error)
+	TouchSession(ctx context.Context, id string) (err error)
+	ListActiveSessions(ctx context.Context, userId int64) (output []Session, err error)
+	RevokeSession(ctx context.Context, userId int64, id string) (err error)
+	RevokeOtherSessions(ctx context.Context, userId int64, currentId string) (revokedIds []string, err error)
+	UpdatePassword(ctx context.Context, id int64, password, salt string) (err error)
+	CreatePasswordResetCode(ctx context.Context, input CreatePasswordResetCodeInput) (err error)
+	FindActivePasswordResetCode(ctx context.Context, userId int64) (output PasswordResetCode, err error)
+	IncrementPasswordResetAttempts(ctx context.Context, id int64) (attempts int, err error)
+	ConsumePasswordResetCode(ctx context.Context, id int64) (consumed bool, err error)
+	CreatePhoneVerification(ctx context.Context, input CreatePhoneVerificationInput) (err error)
+	FindActivePhoneVerification(ctx context.Context, userId int64) (output PhoneVerification, err error)
+	CountPhoneVerificationsSince(ctx context.Context, userId int64, since time.Time) (count int, err error)
+	IncrementPhoneVerificationAttempts(ctx context.Context, id int64) (attempts int, err error)
+	ConfirmPhoneVerification(ctx context.Context, id int64) (confirmed bool, err error)
+	CreateLoginOTP(ctx context.Context, input CreateLoginOTPInput) (err error)
+	FindActiveLoginOTP(ctx context.Context, phoneNumber string) (output LoginOTP, err error)
+	CountLoginOTPsSince(ctx context.Context, phoneNumber string, since time.Time) (count int, err error)
+	IncrementLoginOTPAttempts(ctx context.Context, id int64) (attempts int, err error)
+	ConsumeLoginOTP(ctx context.Context, id int64) (consumed bool, err error)
+	SaveTOTPSecret(ctx context.Context, userId int64, secret string) (saved bool, err error)
+	FindTOTP(ctx context.Context, userId int64) (output TOTP, err error)
+	ConfirmTOTP(ctx context.Context, userId int64, step int64) (err error)
+	UseTOTPStep(ctx context.Context, userId int64, step int64) (used bool, err error)
+	DeleteTOTP(ctx context.Context, userId int64) (err error)
+	CreateMFAChallenge(ctx context.Context, input CreateMFAChallengeInput) (err error)
+	FindActiveMFAChallenge(ctx context.Context, tokenHash string) (output MFAChallenge, err error)
+	IncrementMFAChallengeAttempts(ctx context.Context, id int64) (attempts int, err error)
+	ConsumeMFAChallenge(ctx context.Context, id int64) (consumed bool, err error)
+	ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) (err error)
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (used bool, err error)
+	CreateAuditLog(ctx context.Context, input CreateAuditLogInput) (err error)
+	FindOAuthClient(ctx context.Context, clientId string) (output OAuthClient, err error)
+	FindSession(ctx context.Context, id string) (output Session, err error)
+	CreateAuthorizationCode(ctx context.Context, input CreateAuthorizationCodeInput) (err error)
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (output AuthorizationCode, err error)
+	FindUserRoles(ctx context.Context, userId int64) (output []Role, err error)
+	AssignRole(ctx context.Context, userId int64, role string) (err error)
+	BootstrapRole(ctx context.Context, role string, userIds []int64) (assigned bool, err error)
+	RevokeRole(ctx context.Context, userId int64, role string) (err error)
+	ListUsers(ctx context.Context, input ListUsersInput) (output []User, err error)
+	CreateUserAccount(ctx context.Context, input CreateUserAccountInput, audit CreateAuditLogInput) (output CreateUserOutput, err error)
+	UpdateUserAccount(ctx context.Context, id int64, input UpdateUserAccountInput, audit CreateAuditLogInput) (err error)
+	ResetUserPassword(ctx context.Context, id int64, password string, audit CreateAuditLogInput) (err error)
+	LockUser(ctx context.Context, id int64, until time.Time, audit CreateAuditLogInput) (err error)
+	DeactivateUser(ctx context.Context, id int64, audit CreateAuditLogInput) (err error)
 }
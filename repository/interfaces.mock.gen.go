@@ -7,6 +7,7 @@ package repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,266 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// AssignRole mocks base method.
+func (m *MockRepositoryInterface) AssignRole(ctx context.Context, userId int64, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssignRole", ctx, userId, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AssignRole indicates an expected call of AssignRole.
+func (mr *MockRepositoryInterfaceMockRecorder) AssignRole(ctx, userId, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssignRole", reflect.TypeOf((*MockRepositoryInterface)(nil).AssignRole), ctx, userId, role)
+}
+
+// BootstrapRole mocks base method.
+func (m *MockRepositoryInterface) BootstrapRole(ctx context.Context, role string, userIds []int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BootstrapRole", ctx, role, userIds)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BootstrapRole indicates an expected call of BootstrapRole.
+func (mr *MockRepositoryInterfaceMockRecorder) BootstrapRole(ctx, role, userIds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BootstrapRole", reflect.TypeOf((*MockRepositoryInterface)(nil).BootstrapRole), ctx, role, userIds)
+}
+
+// ConfirmPhoneVerification mocks base method.
+func (m *MockRepositoryInterface) ConfirmPhoneVerification(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmPhoneVerification", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmPhoneVerification indicates an expected call of ConfirmPhoneVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmPhoneVerification(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmPhoneVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmPhoneVerification), ctx, id)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockRepositoryInterface) ConfirmTOTP(ctx context.Context, userId, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, userId, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmTOTP(ctx, userId, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmTOTP), ctx, userId, step)
+}
+
+// ConsumeAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAuthorizationCode", ctx, codeHash)
+	ret0, _ := ret[0].(AuthorizationCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAuthorizationCode indicates an expected call of ConsumeAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeAuthorizationCode(ctx, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeAuthorizationCode), ctx, codeHash)
+}
+
+// ConsumeLoginOTP mocks base method.
+func (m *MockRepositoryInterface) ConsumeLoginOTP(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeLoginOTP", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeLoginOTP indicates an expected call of ConsumeLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeLoginOTP(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeLoginOTP), ctx, id)
+}
+
+// ConsumeMFAChallenge mocks base method.
+func (m *MockRepositoryInterface) ConsumeMFAChallenge(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeMFAChallenge", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeMFAChallenge indicates an expected call of ConsumeMFAChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumeMFAChallenge(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeMFAChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumeMFAChallenge), ctx, id)
+}
+
+// ConsumePasswordResetCode mocks base method.
+func (m *MockRepositoryInterface) ConsumePasswordResetCode(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumePasswordResetCode", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumePasswordResetCode indicates an expected call of ConsumePasswordResetCode.
+func (mr *MockRepositoryInterfaceMockRecorder) ConsumePasswordResetCode(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumePasswordResetCode", reflect.TypeOf((*MockRepositoryInterface)(nil).ConsumePasswordResetCode), ctx, id)
+}
+
+// CountLoginOTPsSince mocks base method.
+func (m *MockRepositoryInterface) CountLoginOTPsSince(ctx context.Context, phoneNumber string, since time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountLoginOTPsSince", ctx, phoneNumber, since)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountLoginOTPsSince indicates an expected call of CountLoginOTPsSince.
+func (mr *MockRepositoryInterfaceMockRecorder) CountLoginOTPsSince(ctx, phoneNumber, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountLoginOTPsSince", reflect.TypeOf((*MockRepositoryInterface)(nil).CountLoginOTPsSince), ctx, phoneNumber, since)
+}
+
+// CountPhoneVerificationsSince mocks base method.
+func (m *MockRepositoryInterface) CountPhoneVerificationsSince(ctx context.Context, userId int64, since time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPhoneVerificationsSince", ctx, userId, since)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPhoneVerificationsSince indicates an expected call of CountPhoneVerificationsSince.
+func (mr *MockRepositoryInterfaceMockRecorder) CountPhoneVerificationsSince(ctx, userId, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPhoneVerificationsSince", reflect.TypeOf((*MockRepositoryInterface)(nil).CountPhoneVerificationsSince), ctx, userId, since)
+}
+
+// CreateAuditLog mocks base method.
+func (m *MockRepositoryInterface) CreateAuditLog(ctx context.Context, input CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuditLog", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuditLog indicates an expected call of CreateAuditLog.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateAuditLog(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuditLog", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateAuditLog), ctx, input)
+}
+
+// CreateAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) CreateAuthorizationCode(ctx context.Context, input CreateAuthorizationCodeInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuthorizationCode", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuthorizationCode indicates an expected call of CreateAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateAuthorizationCode(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateAuthorizationCode), ctx, input)
+}
+
+// CreateLoginOTP mocks base method.
+func (m *MockRepositoryInterface) CreateLoginOTP(ctx context.Context, input CreateLoginOTPInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginOTP", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginOTP indicates an expected call of CreateLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateLoginOTP(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateLoginOTP), ctx, input)
+}
+
+// CreateMFAChallenge mocks base method.
+func (m *MockRepositoryInterface) CreateMFAChallenge(ctx context.Context, input CreateMFAChallengeInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMFAChallenge", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMFAChallenge indicates an expected call of CreateMFAChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateMFAChallenge(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMFAChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateMFAChallenge), ctx, input)
+}
+
+// CreatePasswordResetCode mocks base method.
+func (m *MockRepositoryInterface) CreatePasswordResetCode(ctx context.Context, input CreatePasswordResetCodeInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetCode", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetCode indicates an expected call of CreatePasswordResetCode.
+func (mr *MockRepositoryInterfaceMockRecorder) CreatePasswordResetCode(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetCode", reflect.TypeOf((*MockRepositoryInterface)(nil).CreatePasswordResetCode), ctx, input)
+}
+
+// CreatePhoneVerification mocks base method.
+func (m *MockRepositoryInterface) CreatePhoneVerification(ctx context.Context, input CreatePhoneVerificationInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePhoneVerification", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePhoneVerification indicates an expected call of CreatePhoneVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) CreatePhoneVerification(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePhoneVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).CreatePhoneVerification), ctx, input)
+}
+
+// CreateRefreshToken mocks base method.
+func (m *MockRepositoryInterface) CreateRefreshToken(ctx context.Context, input CreateRefreshTokenInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshToken", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshToken indicates an expected call of CreateRefreshToken.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateRefreshToken(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshToken", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateRefreshToken), ctx, input)
+}
+
+// CreateSession mocks base method.
+func (m *MockRepositoryInterface) CreateSession(ctx context.Context, input CreateSessionInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateSession(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateSession), ctx, input)
+}
+
 // CreateUser mocks base method.
 func (m *MockRepositoryInterface) CreateUser(ctx context.Context, input CreateUserInput) (CreateUserOutput, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +310,169 @@ func (mr *MockRepositoryInterfaceMockRecorder) CreateUser(ctx, input interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateUser), ctx, input)
 }
 
+// CreateUserAccount mocks base method.
+func (m *MockRepositoryInterface) CreateUserAccount(ctx context.Context, input CreateUserAccountInput, audit CreateAuditLogInput) (CreateUserOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserAccount", ctx, input, audit)
+	ret0, _ := ret[0].(CreateUserOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUserAccount indicates an expected call of CreateUserAccount.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateUserAccount(ctx, input, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserAccount", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateUserAccount), ctx, input, audit)
+}
+
+// DeactivateUser mocks base method.
+func (m *MockRepositoryInterface) DeactivateUser(ctx context.Context, id int64, audit CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeactivateUser", ctx, id, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeactivateUser indicates an expected call of DeactivateUser.
+func (mr *MockRepositoryInterfaceMockRecorder) DeactivateUser(ctx, id, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeactivateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).DeactivateUser), ctx, id, audit)
+}
+
+// DeleteTOTP mocks base method.
+func (m *MockRepositoryInterface) DeleteTOTP(ctx context.Context, userId int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTOTP", ctx, userId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTOTP indicates an expected call of DeleteTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteTOTP(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteTOTP), ctx, userId)
+}
+
+// FindActiveLoginOTP mocks base method.
+func (m *MockRepositoryInterface) FindActiveLoginOTP(ctx context.Context, phoneNumber string) (LoginOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindActiveLoginOTP", ctx, phoneNumber)
+	ret0, _ := ret[0].(LoginOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindActiveLoginOTP indicates an expected call of FindActiveLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) FindActiveLoginOTP(ctx, phoneNumber interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindActiveLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).FindActiveLoginOTP), ctx, phoneNumber)
+}
+
+// FindActiveMFAChallenge mocks base method.
+func (m *MockRepositoryInterface) FindActiveMFAChallenge(ctx context.Context, tokenHash string) (MFAChallenge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindActiveMFAChallenge", ctx, tokenHash)
+	ret0, _ := ret[0].(MFAChallenge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindActiveMFAChallenge indicates an expected call of FindActiveMFAChallenge.
+func (mr *MockRepositoryInterfaceMockRecorder) FindActiveMFAChallenge(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindActiveMFAChallenge", reflect.TypeOf((*MockRepositoryInterface)(nil).FindActiveMFAChallenge), ctx, tokenHash)
+}
+
+// FindActivePasswordResetCode mocks base method.
+func (m *MockRepositoryInterface) FindActivePasswordResetCode(ctx context.Context, userId int64) (PasswordResetCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindActivePasswordResetCode", ctx, userId)
+	ret0, _ := ret[0].(PasswordResetCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindActivePasswordResetCode indicates an expected call of FindActivePasswordResetCode.
+func (mr *MockRepositoryInterfaceMockRecorder) FindActivePasswordResetCode(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindActivePasswordResetCode", reflect.TypeOf((*MockRepositoryInterface)(nil).FindActivePasswordResetCode), ctx, userId)
+}
+
+// FindActivePhoneVerification mocks base method.
+func (m *MockRepositoryInterface) FindActivePhoneVerification(ctx context.Context, userId int64) (PhoneVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindActivePhoneVerification", ctx, userId)
+	ret0, _ := ret[0].(PhoneVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindActivePhoneVerification indicates an expected call of FindActivePhoneVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) FindActivePhoneVerification(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindActivePhoneVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).FindActivePhoneVerification), ctx, userId)
+}
+
+// FindOAuthClient mocks base method.
+func (m *MockRepositoryInterface) FindOAuthClient(ctx context.Context, clientId string) (OAuthClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOAuthClient", ctx, clientId)
+	ret0, _ := ret[0].(OAuthClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindOAuthClient indicates an expected call of FindOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) FindOAuthClient(ctx, clientId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).FindOAuthClient), ctx, clientId)
+}
+
+// FindRefreshTokenByHash mocks base method.
+func (m *MockRepositoryInterface) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRefreshTokenByHash", ctx, tokenHash)
+	ret0, _ := ret[0].(RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRefreshTokenByHash indicates an expected call of FindRefreshTokenByHash.
+func (mr *MockRepositoryInterfaceMockRecorder) FindRefreshTokenByHash(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRefreshTokenByHash", reflect.TypeOf((*MockRepositoryInterface)(nil).FindRefreshTokenByHash), ctx, tokenHash)
+}
+
+// FindSession mocks base method.
+func (m *MockRepositoryInterface) FindSession(ctx context.Context, id string) (Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindSession", ctx, id)
+	ret0, _ := ret[0].(Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindSession indicates an expected call of FindSession.
+func (mr *MockRepositoryInterfaceMockRecorder) FindSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindSession", reflect.TypeOf((*MockRepositoryInterface)(nil).FindSession), ctx, id)
+}
+
+// FindTOTP mocks base method.
+func (m *MockRepositoryInterface) FindTOTP(ctx context.Context, userId int64) (TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTOTP", ctx, userId)
+	ret0, _ := ret[0].(TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTOTP indicates an expected call of FindTOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) FindTOTP(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).FindTOTP), ctx, userId)
+}
+
 // FindUserById mocks base method.
 func (m *MockRepositoryInterface) FindUserById(ctx context.Context, id int64) (User, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +503,326 @@ func (mr *MockRepositoryInterfaceMockRecorder) FindUserByPhoneNumber(ctx, phoneN
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByPhoneNumber", reflect.TypeOf((*MockRepositoryInterface)(nil).FindUserByPhoneNumber), ctx, phoneNumber)
 }
 
+// FindUserRoles mocks base method.
+func (m *MockRepositoryInterface) FindUserRoles(ctx context.Context, userId int64) ([]Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserRoles", ctx, userId)
+	ret0, _ := ret[0].([]Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserRoles indicates an expected call of FindUserRoles.
+func (mr *MockRepositoryInterfaceMockRecorder) FindUserRoles(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserRoles", reflect.TypeOf((*MockRepositoryInterface)(nil).FindUserRoles), ctx, userId)
+}
+
+// IncrementFailedLogin mocks base method.
+func (m *MockRepositoryInterface) IncrementFailedLogin(ctx context.Context, id int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementFailedLogin", ctx, id)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementFailedLogin indicates an expected call of IncrementFailedLogin.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementFailedLogin(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementFailedLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementFailedLogin), ctx, id)
+}
+
+// IncrementLoginOTPAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementLoginOTPAttempts(ctx context.Context, id int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementLoginOTPAttempts", ctx, id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementLoginOTPAttempts indicates an expected call of IncrementLoginOTPAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementLoginOTPAttempts(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementLoginOTPAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementLoginOTPAttempts), ctx, id)
+}
+
+// IncrementMFAChallengeAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementMFAChallengeAttempts(ctx context.Context, id int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementMFAChallengeAttempts", ctx, id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementMFAChallengeAttempts indicates an expected call of IncrementMFAChallengeAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementMFAChallengeAttempts(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementMFAChallengeAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementMFAChallengeAttempts), ctx, id)
+}
+
+// IncrementPasswordResetAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementPasswordResetAttempts(ctx context.Context, id int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPasswordResetAttempts", ctx, id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementPasswordResetAttempts indicates an expected call of IncrementPasswordResetAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementPasswordResetAttempts(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPasswordResetAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementPasswordResetAttempts), ctx, id)
+}
+
+// IncrementPhoneVerificationAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementPhoneVerificationAttempts(ctx context.Context, id int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPhoneVerificationAttempts", ctx, id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementPhoneVerificationAttempts indicates an expected call of IncrementPhoneVerificationAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementPhoneVerificationAttempts(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPhoneVerificationAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementPhoneVerificationAttempts), ctx, id)
+}
+
+// IncrementSuccessfulLogin mocks base method.
+func (m *MockRepositoryInterface) IncrementSuccessfulLogin(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementSuccessfulLogin", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementSuccessfulLogin indicates an expected call of IncrementSuccessfulLogin.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementSuccessfulLogin(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementSuccessfulLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementSuccessfulLogin), ctx, id)
+}
+
+// ListActiveSessions mocks base method.
+func (m *MockRepositoryInterface) ListActiveSessions(ctx context.Context, userId int64) ([]Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListActiveSessions", ctx, userId)
+	ret0, _ := ret[0].([]Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListActiveSessions indicates an expected call of ListActiveSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) ListActiveSessions(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListActiveSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).ListActiveSessions), ctx, userId)
+}
+
+// ListUsers mocks base method.
+func (m *MockRepositoryInterface) ListUsers(ctx context.Context, input ListUsersInput) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, input)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockRepositoryInterfaceMockRecorder) ListUsers(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockRepositoryInterface)(nil).ListUsers), ctx, input)
+}
+
+// LockUser mocks base method.
+func (m *MockRepositoryInterface) LockUser(ctx context.Context, id int64, until time.Time, audit CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockUser", ctx, id, until, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockUser indicates an expected call of LockUser.
+func (mr *MockRepositoryInterfaceMockRecorder) LockUser(ctx, id, until, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockUser", reflect.TypeOf((*MockRepositoryInterface)(nil).LockUser), ctx, id, until, audit)
+}
+
+// MarkRefreshTokenUsed mocks base method.
+func (m *MockRepositoryInterface) MarkRefreshTokenUsed(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRefreshTokenUsed", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkRefreshTokenUsed indicates an expected call of MarkRefreshTokenUsed.
+func (mr *MockRepositoryInterfaceMockRecorder) MarkRefreshTokenUsed(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRefreshTokenUsed", reflect.TypeOf((*MockRepositoryInterface)(nil).MarkRefreshTokenUsed), ctx, id)
+}
+
+// ReplaceRecoveryCodes mocks base method.
+func (m *MockRepositoryInterface) ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodes", ctx, userId, codeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodes indicates an expected call of ReplaceRecoveryCodes.
+func (mr *MockRepositoryInterfaceMockRecorder) ReplaceRecoveryCodes(ctx, userId, codeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodes", reflect.TypeOf((*MockRepositoryInterface)(nil).ReplaceRecoveryCodes), ctx, userId, codeHashes)
+}
+
+// ResetUserPassword mocks base method.
+func (m *MockRepositoryInterface) ResetUserPassword(ctx context.Context, id int64, password string, audit CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetUserPassword", ctx, id, password, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetUserPassword indicates an expected call of ResetUserPassword.
+func (mr *MockRepositoryInterfaceMockRecorder) ResetUserPassword(ctx, id, password, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetUserPassword", reflect.TypeOf((*MockRepositoryInterface)(nil).ResetUserPassword), ctx, id, password, audit)
+}
+
+// RevokeOtherSessions mocks base method.
+func (m *MockRepositoryInterface) RevokeOtherSessions(ctx context.Context, userId int64, currentId string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOtherSessions", ctx, userId, currentId)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeOtherSessions indicates an expected call of RevokeOtherSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeOtherSessions(ctx, userId, currentId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOtherSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeOtherSessions), ctx, userId, currentId)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockRepositoryInterface) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", ctx, familyId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeRefreshTokenFamily(ctx, familyId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeRefreshTokenFamily), ctx, familyId)
+}
+
+// RevokeRole mocks base method.
+func (m *MockRepositoryInterface) RevokeRole(ctx context.Context, userId int64, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRole", ctx, userId, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRole indicates an expected call of RevokeRole.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeRole(ctx, userId, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRole", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeRole), ctx, userId, role)
+}
+
+// RevokeSession mocks base method.
+func (m *MockRepositoryInterface) RevokeSession(ctx context.Context, userId int64, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, userId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeSession(ctx, userId, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeSession), ctx, userId, id)
+}
+
+// RevokeUserRefreshTokens mocks base method.
+func (m *MockRepositoryInterface) RevokeUserRefreshTokens(ctx context.Context, userId int64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserRefreshTokens", ctx, userId)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeUserRefreshTokens indicates an expected call of RevokeUserRefreshTokens.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeUserRefreshTokens(ctx, userId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserRefreshTokens", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeUserRefreshTokens), ctx, userId)
+}
+
+// SaveTOTPSecret mocks base method.
+func (m *MockRepositoryInterface) SaveTOTPSecret(ctx context.Context, userId int64, secret string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTPSecret", ctx, userId, secret)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveTOTPSecret indicates an expected call of SaveTOTPSecret.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveTOTPSecret(ctx, userId, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTPSecret", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveTOTPSecret), ctx, userId, secret)
+}
+
+// TouchSession mocks base method.
+func (m *MockRepositoryInterface) TouchSession(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockRepositoryInterfaceMockRecorder) TouchSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockRepositoryInterface)(nil).TouchSession), ctx, id)
+}
+
+// UnlockUser mocks base method.
+func (m *MockRepositoryInterface) UnlockUser(ctx context.Context, id int64, audit CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlockUser", ctx, id, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlockUser indicates an expected call of UnlockUser.
+func (mr *MockRepositoryInterfaceMockRecorder) UnlockUser(ctx, id, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UnlockUser), ctx, id, audit)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockRepositoryInterface) UpdatePassword(ctx context.Context, id int64, password, salt string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, password, salt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdatePassword(ctx, id, password, salt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdatePassword), ctx, id, password, salt)
+}
+
 // UpdateUser mocks base method.
 func (m *MockRepositoryInterface) UpdateUser(ctx context.Context, name, phoneNumber *string, id int64) error {
 	m.ctrl.T.Helper()
@@ -92,3 +836,47 @@ func (mr *MockRepositoryInterfaceMockRecorder) UpdateUser(ctx, name, phoneNumber
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUser), ctx, name, phoneNumber, id)
 }
+
+// UpdateUserAccount mocks base method.
+func (m *MockRepositoryInterface) UpdateUserAccount(ctx context.Context, id int64, input UpdateUserAccountInput, audit CreateAuditLogInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserAccount", ctx, id, input, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserAccount indicates an expected call of UpdateUserAccount.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserAccount(ctx, id, input, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserAccount", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserAccount), ctx, id, input, audit)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepositoryInterface) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userId, codeHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryInterfaceMockRecorder) UseRecoveryCode(ctx, userId, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepositoryInterface)(nil).UseRecoveryCode), ctx, userId, codeHash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockRepositoryInterface) UseTOTPStep(ctx context.Context, userId, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userId, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockRepositoryInterfaceMockRecorder) UseTOTPStep(ctx, userId, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockRepositoryInterface)(nil).UseTOTPStep), ctx, userId, step)
+}
@@ -1,6 +1,8 @@
 // This file contains types that are used in the repository layer.
 package repository
 
+import "time"
+
 type GetTestByIdInput struct {
 	Id string
 }
@@ -26,4 +28,388 @@ type User struct {
 	FullName       string
 	PhoneNumber    string
 	Password, Salt string
+
+	SuccessfulLoginCount int64
+	FailedLoginCount     int64
+	LastLoginAt          *time.Time
+	LastFailedLoginAt    *time.Time
+	LockedUntil          *time.Time
+
+	PhoneVerifiedAt *time.Time
+	DeactivatedAt   *time.Time
+	CreatedAt       time.Time
+}
+
+// Statuses of a user, see User.Status.
+const (
+	UserStatusActive      = "active"
+	UserStatusLocked      = "locked"
+	UserStatusDeactivated = "deactivated"
+)
+
+// Status tells whether the user can log in. A locked user can again once
+// LockedUntil has passed, a deactivated user never.
+func (u User) Status() string {
+	switch {
+	case u.DeactivatedAt != nil:
+		return UserStatusDeactivated
+	case u.LockedUntil != nil && u.LockedUntil.After(time.Now()):
+		return UserStatusLocked
+	}
+	return UserStatusActive
+}
+
+// Key returns the position of the user in a list sorted by the given column.
+func (u User) Key(sortBy string) UserKey {
+	key := UserKey{Id: u.Id}
+	switch sortBy {
+	case UserSortCreatedAt:
+		key.Value = u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case UserSortName:
+		key.Value = u.FullName
+	case UserSortPhoneNumber:
+		key.Value = u.PhoneNumber
+	}
+	return key
+}
+
+// Orders ListUsers can return users in.
+const (
+	UserSortId          = "id"
+	UserSortCreatedAt   = "created_at"
+	UserSortName        = "name"
+	UserSortPhoneNumber = "phone_number"
+)
+
+type (
+	// ListUsersInput filters the users to list, empty fields match any user.
+	ListUsersInput struct {
+		// Name matches a part of the name, ignoring case.
+		Name string
+		// PhoneNumber matches the start of the phone number.
+		PhoneNumber string
+		Status      string
+		// CreatedFrom and CreatedTo match users created at or after, and
+		// before the given times.
+		CreatedFrom *time.Time
+		CreatedTo   *time.Time
+
+		// SortBy is one of the UserSort constants, UserSortId by default.
+		// Users with the same value are ordered by id.
+		SortBy     string
+		Descending bool
+		// After continues the list after the user with the key, see
+		// User.Key. It must be taken with the same SortBy and Descending.
+		After *UserKey
+		Limit int
+	}
+
+	// UserKey is the position of a user in a sorted list.
+	UserKey struct {
+		Id int64
+		// Value is the value of the sorted by column, empty when sorted by id.
+		Value string
+	}
+
+	// CreateUserAccountInput creates a user whose phone number an admin may
+	// have verified already.
+	CreateUserAccountInput struct {
+		CreateUserInput
+		PhoneVerified bool
+	}
+
+	// UpdateUserAccountInput changes the fields that are not nil.
+	UpdateUserAccountInput struct {
+		FullName      *string
+		PhoneNumber   *string
+		PhoneVerified *bool
+	}
+)
+
+// LockoutPolicy locks an account for LockoutDuration once MaxFailedAttempts
+// failed logins happen within FailureWindow. Every repeated lockout doubles
+// the duration, capped at MaxLockoutDuration. The cap can not be removed, a
+// zero MaxLockoutDuration means the default one.
+type LockoutPolicy struct {
+	MaxFailedAttempts  int
+	FailureWindow      time.Duration
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailedAttempts:  5,
+		FailureWindow:      15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockoutDuration: 24 * time.Hour,
+	}
+}
+
+// withDefaults replaces the values that would lock accounts on every failed
+// login, or never unlock them, with those of DefaultLockoutPolicy.
+func (p LockoutPolicy) withDefaults() LockoutPolicy {
+	defaults := DefaultLockoutPolicy()
+	if p == (LockoutPolicy{}) {
+		return defaults
+	}
+	if p.MaxFailedAttempts < 1 {
+		p.MaxFailedAttempts = defaults.MaxFailedAttempts
+	}
+	if p.FailureWindow <= 0 {
+		p.FailureWindow = defaults.FailureWindow
+	}
+	if p.LockoutDuration <= 0 {
+		p.LockoutDuration = defaults.LockoutDuration
+	}
+	if p.MaxLockoutDuration <= 0 {
+		p.MaxLockoutDuration = defaults.MaxLockoutDuration
+	}
+	return p
+}
+
+// failedLogins is the state IncrementFailedLogin keeps per user.
+type failedLogins struct {
+	attemptsInWindow int
+	windowStartedAt  *time.Time
+	lockoutCount     int
+}
+
+// recordFailure counts a failed login at now and returns when the account
+// is locked until, or nil when it is not locked by this failure.
+func (p LockoutPolicy) recordFailure(state failedLogins, now time.Time) (failedLogins, *time.Time) {
+	if state.windowStartedAt == nil || now.Sub(*state.windowStartedAt) > p.FailureWindow {
+		state.attemptsInWindow, state.windowStartedAt = 0, &now
+	}
+	state.attemptsInWindow++
+
+	if state.attemptsInWindow < p.MaxFailedAttempts {
+		return state, nil
+	}
+
+	state.lockoutCount++
+	lockedUntil := now.Add(p.lockoutDurationFor(state.lockoutCount))
+	state.attemptsInWindow, state.windowStartedAt = 0, nil
+	return state, &lockedUntil
+}
+
+// lockoutDurationFor returns how long the account is locked for its n-th
+// consecutive lockout, starting from n = 1.
+func (p LockoutPolicy) lockoutDurationFor(n int) time.Duration {
+	maxDuration := p.MaxLockoutDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultLockoutPolicy().MaxLockoutDuration
+	}
+
+	duration := p.LockoutDuration
+	for i := 1; i < n && duration < maxDuration; i++ {
+		// doubling a duration above half the cap could overflow
+		if duration > maxDuration/2 {
+			duration = maxDuration
+			break
+		}
+		duration *= 2
+	}
+	if duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+type (
+	CreateRefreshTokenInput struct {
+		UserId    int64
+		FamilyId  string
+		TokenHash string
+		ExpiresAt time.Time
+	}
+
+	// RefreshToken is a hashed opaque refresh token. Tokens issued from the
+	// same login share a FamilyId, and each token can be used only once.
+	RefreshToken struct {
+		Id        int64
+		UserId    int64
+		FamilyId  string
+		TokenHash string
+		ExpiresAt time.Time
+		UsedAt    *time.Time
+		RevokedAt *time.Time
+	}
+)
+
+type (
+	CreateSessionInput struct {
+		Id          string
+		UserId      int64
+		UserAgent   string
+		IpAddress   string
+		DeviceLabel string
+		// ClientId and Scope are only set for a session an OAuth client
+		// started with the authorization code grant.
+		ClientId string
+		Scope    string
+	}
+
+	Session struct {
+		Id          string
+		UserId      int64
+		UserAgent   string
+		IpAddress   string
+		DeviceLabel string
+		ClientId    string
+		Scope       string
+		CreatedAt   time.Time
+		LastSeenAt  time.Time
+	}
+)
+
+type (
+	CreatePasswordResetCodeInput struct {
+		UserId    int64
+		CodeHash  string
+		ExpiresAt time.Time
+	}
+
+	PasswordResetCode struct {
+		Id        int64
+		UserId    int64
+		CodeHash  string
+		Attempts  int
+		ExpiresAt time.Time
+		CreatedAt time.Time
+	}
+)
+
+type (
+	CreatePhoneVerificationInput struct {
+		UserId      int64
+		PhoneNumber string
+		CodeHash    string
+		ExpiresAt   time.Time
+	}
+
+	// PhoneVerification is a code sent by SMS to PhoneNumber. Confirming it
+	// makes PhoneNumber the verified phone number of the user.
+	PhoneVerification struct {
+		Id          int64
+		UserId      int64
+		PhoneNumber string
+		CodeHash    string
+		Attempts    int
+		ExpiresAt   time.Time
+		CreatedAt   time.Time
+	}
+)
+
+type (
+	CreateLoginOTPInput struct {
+		UserId      int64
+		PhoneNumber string
+		CodeHash    string
+		ExpiresAt   time.Time
+	}
+
+	// LoginOTP is a one-time code sent by SMS to login without a password.
+	LoginOTP struct {
+		Id          int64
+		UserId      int64
+		PhoneNumber string
+		CodeHash    string
+		Attempts    int
+		ExpiresAt   time.Time
+		CreatedAt   time.Time
+	}
+)
+
+// TOTP is the authenticator app of a user, two-factor authentication is
+// enabled once it is confirmed.
+type TOTP struct {
+	UserId int64
+	// Secret is encrypted, see secretbox.
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+}
+
+type (
+	CreateMFAChallengeInput struct {
+		UserId      int64
+		TokenHash   string
+		DeviceLabel string
+		ExpiresAt   time.Time
+	}
+
+	// MFAChallenge is handed out by a login with the correct password and is
+	// exchanged for tokens together with a second factor.
+	MFAChallenge struct {
+		Id          int64
+		UserId      int64
+		TokenHash   string
+		DeviceLabel string
+		Attempts    int
+		ExpiresAt   time.Time
+	}
+)
+
+type CreateAuditLogInput struct {
+	// ActorId is the user who performed the action, UserId the user it was
+	// performed on.
+	ActorId   int64
+	UserId    int64
+	Action    string
+	IpAddress string
+	UserAgent string
+	// Details describes the change, e.g. every changed field with its old
+	// and new value as an AuditChange. It is stored as JSON.
+	Details map[string]any
+}
+
+// AuditChange is the old and new value of a field changed by an action.
+type AuditChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// OAuthClient is a service that authenticates with its client id and secret,
+// or an app that signs users in with the authorization code grant. A public
+// client, such as a single page app, can not keep a secret and has none.
+type OAuthClient struct {
+	ClientId     string
+	SecretHash   string
+	Scopes       []string
+	RedirectURIs []string
+}
+
+// IsPublic reports whether the client has no secret to authenticate with.
+func (c OAuthClient) IsPublic() bool { return c.SecretHash == "" }
+
+type (
+	CreateAuthorizationCodeInput struct {
+		CodeHash      string
+		ClientId      string
+		UserId        int64
+		RedirectURI   string
+		Scope         string
+		Nonce         string
+		CodeChallenge string
+		ExpiresAt     time.Time
+	}
+
+	// AuthorizationCode is handed to a client once the user signed in, and is
+	// exchanged once for tokens by the client that requested it.
+	AuthorizationCode struct {
+		ClientId      string
+		UserId        int64
+		RedirectURI   string
+		Scope         string
+		Nonce         string
+		CodeChallenge string
+		CreatedAt     time.Time
+	}
+)
+
+// Role is a role of a user with the permissions it grants.
+type Role struct {
+	Name        string
+	Permissions []string
 }
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy_lockoutDurationFor(t *testing.T) {
+	policy := LockoutPolicy{LockoutDuration: 15 * time.Minute, MaxLockoutDuration: time.Hour}
+
+	tests := []struct {
+		name     string
+		n        int
+		duration time.Duration
+	}{
+		{name: "First Lockout", n: 1, duration: 15 * time.Minute},
+		{name: "Second Lockout Doubles", n: 2, duration: 30 * time.Minute},
+		{name: "Third Lockout Reaches Max", n: 3, duration: time.Hour},
+		{name: "Capped At Max", n: 4, duration: time.Hour},
+		{name: "Many Lockouts Do Not Overflow", n: 100, duration: time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.duration, policy.lockoutDurationFor(tt.n))
+		})
+	}
+
+	t.Run("Without Max Uses Default Cap", func(t *testing.T) {
+		uncapped := LockoutPolicy{LockoutDuration: time.Minute}
+		assert.Equal(t, 8*time.Minute, uncapped.lockoutDurationFor(4))
+		assert.Equal(t, DefaultLockoutPolicy().MaxLockoutDuration, uncapped.lockoutDurationFor(100))
+	})
+
+	t.Run("Max Near Overflow", func(t *testing.T) {
+		capped := LockoutPolicy{LockoutDuration: time.Hour, MaxLockoutDuration: math.MaxInt64}
+		assert.Equal(t, time.Duration(math.MaxInt64), capped.lockoutDurationFor(100))
+	})
+
+	t.Run("Duration Above Max", func(t *testing.T) {
+		capped := LockoutPolicy{LockoutDuration: 2 * time.Hour, MaxLockoutDuration: time.Hour}
+		assert.Equal(t, time.Hour, capped.lockoutDurationFor(1))
+	})
+}
+
+func TestLockoutPolicy_recordFailure(t *testing.T) {
+	var (
+		policy = LockoutPolicy{
+			MaxFailedAttempts:  3,
+			FailureWindow:      15 * time.Minute,
+			LockoutDuration:    15 * time.Minute,
+			MaxLockoutDuration: time.Hour,
+		}
+		now = time.Now()
+	)
+
+	t.Run("First Failure Starts Window", func(t *testing.T) {
+		state, lockedUntil := policy.recordFailure(failedLogins{}, now)
+		assert.Nil(t, lockedUntil)
+		assert.Equal(t, 1, state.attemptsInWindow)
+		assert.Equal(t, &now, state.windowStartedAt)
+	})
+
+	t.Run("Failure Within Window", func(t *testing.T) {
+		started := now.Add(-time.Minute)
+		state, lockedUntil := policy.recordFailure(failedLogins{attemptsInWindow: 1, windowStartedAt: &started}, now)
+		assert.Nil(t, lockedUntil)
+		assert.Equal(t, 2, state.attemptsInWindow)
+		assert.Equal(t, &started, state.windowStartedAt)
+	})
+
+	t.Run("Failure After Window Restarts It", func(t *testing.T) {
+		started := now.Add(-time.Hour)
+		state, lockedUntil := policy.recordFailure(failedLogins{attemptsInWindow: 2, windowStartedAt: &started}, now)
+		assert.Nil(t, lockedUntil)
+		assert.Equal(t, 1, state.attemptsInWindow)
+		assert.Equal(t, &now, state.windowStartedAt)
+	})
+
+	t.Run("Last Attempt Locks", func(t *testing.T) {
+		started := now.Add(-time.Minute)
+		state, lockedUntil := policy.recordFailure(failedLogins{attemptsInWindow: 2, windowStartedAt: &started}, now)
+		assert.Equal(t, now.Add(15*time.Minute), *lockedUntil)
+		assert.Equal(t, failedLogins{lockoutCount: 1}, state)
+	})
+
+	t.Run("Repeated Lockout Backs Off", func(t *testing.T) {
+		started := now.Add(-time.Minute)
+		state, lockedUntil := policy.recordFailure(
+			failedLogins{attemptsInWindow: 2, windowStartedAt: &started, lockoutCount: 1}, now)
+		assert.Equal(t, now.Add(30*time.Minute), *lockedUntil)
+		assert.Equal(t, 2, state.lockoutCount)
+	})
+}
+
+func TestLockoutPolicy_withDefaults(t *testing.T) {
+	defaults := DefaultLockoutPolicy()
+
+	t.Run("Zero Value", func(t *testing.T) {
+		assert.Equal(t, defaults, LockoutPolicy{}.withDefaults())
+	})
+
+	t.Run("Invalid Values", func(t *testing.T) {
+		policy := LockoutPolicy{
+			MaxFailedAttempts:  -1,
+			FailureWindow:      -time.Minute,
+			LockoutDuration:    -time.Minute,
+			MaxLockoutDuration: -time.Minute,
+		}
+		assert.Equal(t, defaults, policy.withDefaults())
+	})
+
+	t.Run("Valid Values", func(t *testing.T) {
+		policy := LockoutPolicy{
+			MaxFailedAttempts:  1,
+			FailureWindow:      time.Minute,
+			LockoutDuration:    time.Minute,
+			MaxLockoutDuration: time.Hour,
+		}
+		assert.Equal(t, policy, policy.withDefaults())
+	})
+
+	t.Run("Zero Max Uses Default Cap", func(t *testing.T) {
+		policy := LockoutPolicy{
+			MaxFailedAttempts: 1,
+			FailureWindow:     time.Minute,
+			LockoutDuration:   time.Minute,
+		}
+		assert.Equal(t, defaults.MaxLockoutDuration, policy.withDefaults().MaxLockoutDuration)
+	})
+}
@@ -1,84 +1,132 @@
 package jwt
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"context"
+	"fmt"
 	"os"
-	"reflect"
+	"os/signal"
 	"sync"
+	"time"
 )
 
 //go:generate mockgen -source=./interfaces.go -destination=./interfaces.mock.gen.go -package=jwt
 
 type Signer interface {
-	CreateAccessToken(userId int64) (string, error)
+	// CreateAccessToken creates an access token of the user, granted the
+	// scopes and carrying the roles they follow from.
+	CreateAccessToken(userId int64, sessionId string, roles, scopes []string) (string, error)
+	// CreateDelegatedAccessToken creates an access token of the user for
+	// the client the user signed in to, granted only the scopes the user
+	// agreed to.
+	CreateDelegatedAccessToken(userId int64, sessionId, clientId string, scopes []string) (string, error)
+	// CreateClientToken creates an access token for a client of the
+	// client_credentials grant.
+	CreateClientToken(clientId string, scopes []string) (string, error)
+	// CreateIDToken creates an OpenID Connect ID token telling the client
+	// that the user signed in, see IDTokenClaims.
+	CreateIDToken(userId int64, clientId string, claims IDTokenClaims) (string, error)
+	AccessTokenTTL() time.Duration
+	// Issuer returns the iss claim of the tokens, which is also the issuer
+	// identifier of the OpenID Connect provider.
+	Issuer() string
 	ParseWithClaims(token string) (claims *Claims, err error)
+	// PublicKeys returns the keys tokens are verified with, for publishing
+	// as a JSON Web Key Set.
+	PublicKeys() []JSONWebKey
 }
 
-type rs256Signer struct {
-	publicKey  *rsa.PublicKey
-	privateKey *rsa.PrivateKey
+type Options struct {
+	// AccessTokenTTL is how long an access token is valid after it is issued.
+	AccessTokenTTL time.Duration
+	// Issuer is set as the iss claim and required when parsing tokens. It
+	// must be the public base URL of the service to sign users in to other
+	// apps with OpenID Connect.
+	Issuer string
+	// Audience is set as the aud claim and required when parsing tokens.
+	Audience string
+	// Leeway is the tolerated clock skew when validating exp, nbf and iat.
+	Leeway time.Duration
 }
 
-func GetSigner() Signer {
-	once.Do(func() {
-		signer = &rs256Signer{
-			publicKey:  readPublicKey(),
-			privateKey: readPrivateKey(),
-		}
-	})
-
-	return signer
-}
-
-var signer Signer
-var once sync.Once
-var basePath string
-
-func init() { basePath, _ = os.Getwd() }
-
-// TODO: need to change get key based on env if needed to go to production (separation for every ENV)
-
-func readPrivateKey() *rsa.PrivateKey {
-	buff, err := os.ReadFile(basePath + "/etc/jwt/private.key")
-	if err != nil {
-		panic("failed to read private key, err: " + err.Error())
+// OptionsFromEnv reads JWT_ACCESS_TOKEN_TTL, JWT_ISSUER, JWT_AUDIENCE and
+// JWT_LEEWAY, falling back to the defaults for the ones that are not set.
+func OptionsFromEnv() Options {
+	opts := Options{
+		AccessTokenTTL: 15 * time.Minute,
+		Issuer:         "sawitpro",
+		Audience:       "sawitpro-user-service",
+		Leeway:         30 * time.Second,
 	}
 
-	block, _ := pem.Decode(buff)
-	if block == nil {
-		panic("failed to read pem block on private key")
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TOKEN_TTL")); err == nil {
+		opts.AccessTokenTTL = ttl
 	}
-
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		panic("failed to parse private key, err: " + err.Error())
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		opts.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		opts.Audience = audience
+	}
+	if leeway, err := time.ParseDuration(os.Getenv("JWT_LEEWAY")); err == nil {
+		opts.Leeway = leeway
 	}
 
-	return key
+	return opts
 }
 
-func readPublicKey() *rsa.PublicKey {
-	buff, err := os.ReadFile(basePath + "/etc/jwt/public.key")
-	if err != nil {
-		panic("failed to read public key, err: " + err.Error())
-	}
+type keyRingSigner struct {
+	keys    *KeyRing
+	options Options
+}
 
-	block, _ := pem.Decode(buff)
-	if block == nil {
-		panic("failed to read pem block on public key")
-	}
+// GetSigner returns the signer configured by the environment, see
+// KeySourceFromEnv and OptionsFromEnv. It is created by the first call.
+func GetSigner() (Signer, error) {
+	once.Do(func() {
+		keys, err := NewKeyRing(KeySourceFromEnv())
+		if err != nil {
+			signerErr = fmt.Errorf("failed to load jwt keys, err: %w", err)
+			return
+		}
 
-	key, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		panic("failed to parse public key, err: " + err.Error())
-	}
+		signer = &keyRingSigner{
+			keys:    keys,
+			options: OptionsFromEnv(),
+		}
+	})
+
+	return signer, signerErr
+}
 
-	rsaKey, ok := key.(*rsa.PublicKey)
-	if !ok {
-		panic("key is not rsa key, instead its " + reflect.TypeOf(key).Name())
+// ReloadKeysOnSignal reloads the keys of the signer returned by GetSigner
+// whenever one of the signals is received, until ctx is done.
+func ReloadKeysOnSignal(ctx context.Context, onReload func(error), signals ...os.Signal) error {
+	s, err := GetSigner()
+	if err != nil {
+		return err
 	}
+	keys := s.(*keyRingSigner).keys
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	go func() {
+		defer signal.Stop(received)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-received:
+				onReload(keys.Reload())
+			}
+		}
+	}()
 
-	return rsaKey
+	return nil
 }
+
+var (
+	signer    Signer
+	signerErr error
+	once      sync.Once
+)
@@ -6,6 +6,7 @@ package jwt
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -33,19 +34,92 @@ func (m *MockSigner) EXPECT() *MockSignerMockRecorder {
 	return m.recorder
 }
 
+// AccessTokenTTL mocks base method.
+func (m *MockSigner) AccessTokenTTL() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccessTokenTTL")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// AccessTokenTTL indicates an expected call of AccessTokenTTL.
+func (mr *MockSignerMockRecorder) AccessTokenTTL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccessTokenTTL", reflect.TypeOf((*MockSigner)(nil).AccessTokenTTL))
+}
+
 // CreateAccessToken mocks base method.
-func (m *MockSigner) CreateAccessToken(userId int64) (string, error) {
+func (m *MockSigner) CreateAccessToken(userId int64, sessionId string, roles, scopes []string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateAccessToken", userId)
+	ret := m.ctrl.Call(m, "CreateAccessToken", userId, sessionId, roles, scopes)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateAccessToken indicates an expected call of CreateAccessToken.
-func (mr *MockSignerMockRecorder) CreateAccessToken(userId interface{}) *gomock.Call {
+func (mr *MockSignerMockRecorder) CreateAccessToken(userId, sessionId, roles, scopes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessToken", reflect.TypeOf((*MockSigner)(nil).CreateAccessToken), userId, sessionId, roles, scopes)
+}
+
+// CreateClientToken mocks base method.
+func (m *MockSigner) CreateClientToken(clientId string, scopes []string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClientToken", clientId, scopes)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateClientToken indicates an expected call of CreateClientToken.
+func (mr *MockSignerMockRecorder) CreateClientToken(clientId, scopes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClientToken", reflect.TypeOf((*MockSigner)(nil).CreateClientToken), clientId, scopes)
+}
+
+// CreateDelegatedAccessToken mocks base method.
+func (m *MockSigner) CreateDelegatedAccessToken(userId int64, sessionId, clientId string, scopes []string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateDelegatedAccessToken", userId, sessionId, clientId, scopes)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateDelegatedAccessToken indicates an expected call of CreateDelegatedAccessToken.
+func (mr *MockSignerMockRecorder) CreateDelegatedAccessToken(userId, sessionId, clientId, scopes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDelegatedAccessToken", reflect.TypeOf((*MockSigner)(nil).CreateDelegatedAccessToken), userId, sessionId, clientId, scopes)
+}
+
+// CreateIDToken mocks base method.
+func (m *MockSigner) CreateIDToken(userId int64, clientId string, claims IDTokenClaims) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIDToken", userId, clientId, claims)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateIDToken indicates an expected call of CreateIDToken.
+func (mr *MockSignerMockRecorder) CreateIDToken(userId, clientId, claims interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessToken", reflect.TypeOf((*MockSigner)(nil).CreateAccessToken), userId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIDToken", reflect.TypeOf((*MockSigner)(nil).CreateIDToken), userId, clientId, claims)
+}
+
+// Issuer mocks base method.
+func (m *MockSigner) Issuer() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Issuer")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Issuer indicates an expected call of Issuer.
+func (mr *MockSignerMockRecorder) Issuer() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Issuer", reflect.TypeOf((*MockSigner)(nil).Issuer))
 }
 
 // ParseWithClaims mocks base method.
@@ -62,3 +136,17 @@ func (mr *MockSignerMockRecorder) ParseWithClaims(token interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseWithClaims", reflect.TypeOf((*MockSigner)(nil).ParseWithClaims), token)
 }
+
+// PublicKeys mocks base method.
+func (m *MockSigner) PublicKeys() []JSONWebKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublicKeys")
+	ret0, _ := ret[0].([]JSONWebKey)
+	return ret0
+}
+
+// PublicKeys indicates an expected call of PublicKeys.
+func (mr *MockSignerMockRecorder) PublicKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublicKeys", reflect.TypeOf((*MockSigner)(nil).PublicKeys))
+}
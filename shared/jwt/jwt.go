@@ -1,36 +1,182 @@
 package jwt
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
 	UserId int64
+	// SessionId is the refresh token family the access token was issued for.
+	SessionId string `json:"sid,omitempty"`
+	// ClientId is only set on tokens issued to a client by the
+	// client_credentials grant, which have no user.
+	ClientId string `json:"client_id,omitempty"`
+	// AuthorizedParty is only set on tokens of a user issued to the client
+	// the user signed in to with OpenID Connect.
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Roles holds the roles of the user when the token was issued.
+	Roles []string `json:"roles,omitempty"`
+	// Scope holds the space separated scopes granted to the token: the
+	// permissions of the roles of a user, or the scopes granted to a client.
+	Scope string `json:"scope,omitempty"`
 }
 
-func (t *rs256Signer) CreateAccessToken(userId int64) (string, error) {
+// IsClient reports whether the token was issued to a client rather than to
+// a user.
+func (c *Claims) IsClient() bool { return c.ClientId != "" }
 
+// IsDelegated reports whether the token of a user was issued to a client
+// rather than to the user itself.
+func (c *Claims) IsDelegated() bool { return c.AuthorizedParty != "" }
+
+// HasScope reports whether the scope is granted to the token.
+func (c *Claims) HasScope(scope string) bool {
+	return containsString(strings.Fields(c.Scope), scope)
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. The registered
+// claims are set by the signer, the others by the caller.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	// Name is only set for the profile scope, the phone number claims only
+	// for the phone scope.
+	Name                string `json:"name,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+}
+
+func (t *keyRingSigner) CreateAccessToken(userId int64, sessionId string, roles, scopes []string) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: t.registeredClaims(strconv.FormatInt(userId, 10)),
+		UserId:           userId,
+		SessionId:        sessionId,
+		Roles:            roles,
+		Scope:            strings.Join(scopes, " "),
+	}
+
+	return t.sign(claims)
+}
+
+func (t *keyRingSigner) CreateDelegatedAccessToken(userId int64, sessionId, clientId string, scopes []string) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: t.registeredClaims(strconv.FormatInt(userId, 10)),
+		UserId:           userId,
+		SessionId:        sessionId,
+		AuthorizedParty:  clientId,
+		Scope:            strings.Join(scopes, " "),
+	}
+
+	return t.sign(claims)
+}
+
+func (t *keyRingSigner) CreateClientToken(clientId string, scopes []string) (string, error) {
 	claims := &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "sawitpro",
-			ExpiresAt: jwt.NewNumericDate(time.Now()),
-		},
-		UserId: userId,
+		RegisteredClaims: t.registeredClaims(clientId),
+		ClientId:         clientId,
+		Scope:            strings.Join(scopes, " "),
+	}
+
+	return t.sign(claims)
+}
+
+// CreateIDToken creates an ID token for the client as its audience, so that
+// it is not accepted as an access token of this service.
+func (t *keyRingSigner) CreateIDToken(userId int64, clientId string, claims IDTokenClaims) (string, error) {
+	claims.RegisteredClaims = t.registeredClaims(strconv.FormatInt(userId, 10))
+	claims.Audience = jwt.ClaimStrings{clientId}
+
+	return t.sign(&claims)
+}
+
+func (t *keyRingSigner) registeredClaims(subject string) jwt.RegisteredClaims {
+	now := time.Now()
+
+	return jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Issuer:    t.options.Issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{t.options.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(t.options.AccessTokenTTL)),
 	}
+}
+
+func (t *keyRingSigner) sign(claims jwt.Claims) (string, error) {
+	key := t.keys.signingKey()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(t.privateKey)
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
 }
 
-func (t *rs256Signer) ParseWithClaims(token string) (claims *Claims, err error) {
+func (t *keyRingSigner) AccessTokenTTL() time.Duration { return t.options.AccessTokenTTL }
+
+func (t *keyRingSigner) Issuer() string { return t.options.Issuer }
+
+func (t *keyRingSigner) PublicKeys() []JSONWebKey { return t.keys.PublicKeys() }
+
+func (t *keyRingSigner) ParseWithClaims(token string) (claims *Claims, err error) {
 	claims = new(Claims)
 
-	_, err = jwt.ParseWithClaims(token, claims, func(_ *jwt.Token) (interface{}, error) { return t.publicKey, nil })
+	// the registered claims are validated below instead of by the parser so
+	// that the configured clock-skew leeway can be applied
+	parser := jwt.NewParser(jwt.WithValidMethods(t.keys.algorithms()), jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(token, claims, t.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.validate(claims, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
 	return claims, nil
 }
+
+// verificationKey returns the public key named by the kid header of the
+// token, which must be signed with the algorithm of the key.
+func (t *keyRingSigner) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+
+	key, ok := t.keys.verificationKey(keyId)
+	if !ok {
+		return nil, errors.New("token is signed with an unknown key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("token is signed with the wrong algorithm for its key")
+	}
+
+	return key.public, nil
+}
+
+func (t *keyRingSigner) validate(claims *Claims, now time.Time) error {
+	leeway := t.options.Leeway
+
+	if !claims.VerifyExpiresAt(now.Add(-leeway), true) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(leeway), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(leeway), true) {
+		return errors.New("token used before issued")
+	}
+	if !claims.VerifyIssuer(t.options.Issuer, true) {
+		return errors.New("token has invalid issuer")
+	}
+	if !claims.VerifyAudience(t.options.Audience, true) {
+		return errors.New("token has invalid audience")
+	}
+
+	return nil
+}
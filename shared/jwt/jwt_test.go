@@ -0,0 +1,183 @@
+package jwt
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) *keyRingSigner {
+	dir := t.TempDir()
+	writeTestKey(t, dir, signingKeyFile, newTestKey(t), true)
+
+	keys, err := NewKeyRing(DirectoryKeySource{Dir: dir})
+	assert.NoError(t, err)
+
+	return &keyRingSigner{
+		keys: keys,
+		options: Options{
+			AccessTokenTTL: time.Minute,
+			Issuer:         "test-issuer",
+			Audience:       "test-audience",
+			Leeway:         10 * time.Second,
+		},
+	}
+}
+
+func TestKeyRingSigner_CreateAccessToken(t *testing.T) {
+	s := newTestSigner(t)
+
+	token, err := s.CreateAccessToken(42, "session", []string{"admin"}, []string{"users:read", "users:unlock"})
+	assert.NoError(t, err)
+
+	claims, err := s.ParseWithClaims(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), claims.UserId)
+	assert.Equal(t, strconv.Itoa(42), claims.Subject)
+	assert.Equal(t, "session", claims.SessionId)
+	assert.False(t, claims.IsClient())
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.True(t, claims.HasScope("users:unlock"))
+	assert.False(t, claims.HasScope("users:write"))
+	assert.Equal(t, jwt.ClaimStrings{"test-audience"}, claims.Audience)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt.Time, 2*time.Second)
+
+	other, err := s.CreateAccessToken(42, "session", nil, nil)
+	assert.NoError(t, err)
+	otherClaims, err := s.ParseWithClaims(other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, claims.ID, otherClaims.ID)
+}
+
+func TestKeyRingSigner_CreateDelegatedAccessToken(t *testing.T) {
+	s := newTestSigner(t)
+
+	token, err := s.CreateDelegatedAccessToken(42, "session", "dashboard", []string{"openid", "profile"})
+	assert.NoError(t, err)
+
+	claims, err := s.ParseWithClaims(token)
+	assert.NoError(t, err)
+	assert.True(t, claims.IsDelegated())
+	assert.False(t, claims.IsClient())
+	assert.Equal(t, int64(42), claims.UserId)
+	assert.Equal(t, "session", claims.SessionId)
+	assert.Equal(t, "dashboard", claims.AuthorizedParty)
+	assert.Equal(t, "openid profile", claims.Scope)
+	assert.Empty(t, claims.Roles)
+}
+
+func TestKeyRingSigner_CreateClientToken(t *testing.T) {
+	s := newTestSigner(t)
+
+	token, err := s.CreateClientToken("billing", []string{"introspect", "users:read"})
+	assert.NoError(t, err)
+
+	claims, err := s.ParseWithClaims(token)
+	assert.NoError(t, err)
+	assert.True(t, claims.IsClient())
+	assert.Equal(t, "billing", claims.ClientId)
+	assert.Equal(t, "billing", claims.Subject)
+	assert.Equal(t, "introspect users:read", claims.Scope)
+	assert.Equal(t, int64(0), claims.UserId)
+	assert.Empty(t, claims.SessionId)
+}
+
+func TestKeyRingSigner_CreateIDToken(t *testing.T) {
+	var (
+		s        = newTestSigner(t)
+		verified = true
+	)
+
+	token, err := s.CreateIDToken(42, "dashboard", IDTokenClaims{
+		Nonce:               "nonce",
+		AuthTime:            1700000000,
+		PhoneNumber:         "+6281234567890",
+		PhoneNumberVerified: &verified,
+	})
+	assert.NoError(t, err)
+
+	claims := &IDTokenClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, s.verificationKey)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, parsed.Header["kid"])
+	assert.Equal(t, "test-issuer", claims.Issuer)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, jwt.ClaimStrings{"dashboard"}, claims.Audience)
+	assert.Equal(t, "nonce", claims.Nonce)
+	assert.Equal(t, int64(1700000000), claims.AuthTime)
+	assert.Empty(t, claims.Name)
+	assert.Equal(t, "+6281234567890", claims.PhoneNumber)
+	assert.Equal(t, &verified, claims.PhoneNumberVerified)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt.Time, 2*time.Second)
+
+	_, err = s.ParseWithClaims(token)
+	assert.Error(t, err)
+}
+
+func TestKeyRingSigner_ParseWithClaims(t *testing.T) {
+	s := newTestSigner(t)
+
+	t.Run("Success Without Key Id", func(t *testing.T) {
+		key := s.keys.signingKey().private
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "test-issuer",
+				Audience:  jwt.ClaimStrings{"test-audience"},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			UserId: 42,
+		}).SignedString(key)
+		assert.NoError(t, err)
+
+		claims, err := s.ParseWithClaims(token)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), claims.UserId)
+	})
+
+	t.Run("Failed Unknown Key", func(t *testing.T) {
+		other := newTestSigner(t)
+		token, err := other.CreateAccessToken(42, "session", nil, nil)
+		assert.NoError(t, err)
+
+		_, err = s.ParseWithClaims(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyRingSigner_validate(t *testing.T) {
+	var (
+		s   = newTestSigner(t)
+		now = time.Now()
+	)
+
+	newClaims := func(exp, nbf time.Time, audience string) *Claims {
+		return &Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "test-issuer",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(nbf),
+			NotBefore: jwt.NewNumericDate(nbf),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		}}
+	}
+
+	t.Run("Success Within Leeway", func(t *testing.T) {
+		assert.NoError(t, s.validate(newClaims(now.Add(-5*time.Second), now.Add(-time.Minute), "test-audience"), now))
+		assert.NoError(t, s.validate(newClaims(now.Add(time.Minute), now.Add(5*time.Second), "test-audience"), now))
+	})
+
+	t.Run("Failed Expired", func(t *testing.T) {
+		assert.Error(t, s.validate(newClaims(now.Add(-time.Minute), now.Add(-2*time.Minute), "test-audience"), now))
+	})
+
+	t.Run("Failed Not Valid Yet", func(t *testing.T) {
+		assert.Error(t, s.validate(newClaims(now.Add(2*time.Minute), now.Add(time.Minute), "test-audience"), now))
+	})
+
+	t.Run("Failed Audience", func(t *testing.T) {
+		assert.Error(t, s.validate(newClaims(now.Add(time.Minute), now, "other-audience"), now))
+	})
+}
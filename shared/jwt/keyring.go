@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+// KeyRing holds the key new tokens are signed with and every key tokens are
+// verified with, identified by the kid header of the token. The algorithm of
+// a key follows from its type: RS256 for RSA, ES256 for ECDSA P-256 and EdDSA
+// for Ed25519 keys.
+//
+// The public key of the signing key always verifies tokens, so a key is
+// rotated without downtime by:
+//  1. adding the public key of the new key pair as a verification key and
+//     reloading every instance,
+//  2. making the new private key the signing key and the old public key a
+//     verification key, and reloading again,
+//  3. removing the old public key once the last token it signed has expired.
+type KeyRing struct {
+	source KeySource
+
+	mu           sync.RWMutex
+	signing      *key
+	verification map[string]*key
+}
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// private is nil for a key that only verifies tokens.
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// NewKeyRing loads the keys of the source.
+func NewKeyRing(source KeySource) (*KeyRing, error) {
+	keys := &KeyRing{source: source}
+
+	err := keys.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Reload reads the keys of the source again. The keys loaded before are kept
+// when any of the keys is invalid.
+func (k *KeyRing) Reload() error {
+	signingPEM, verificationPEMs, err := k.source.Load()
+	if err != nil {
+		return err
+	}
+
+	signingKeys, err := parseKeys(signingPEM)
+	if err != nil {
+		return err
+	}
+	if len(signingKeys) != 1 || signingKeys[0].private == nil {
+		return errors.New("the signing key must be a single private key")
+	}
+
+	var (
+		signing      = signingKeys[0]
+		verification = map[string]*key{signing.id: signing}
+	)
+
+	for _, data := range verificationPEMs {
+		keys, err := parseKeys(data)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, ok := verification[key.id]; !ok {
+				verification[key.id] = key
+			}
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.signing, k.verification = signing, verification
+	return nil
+}
+
+func (k *KeyRing) signingKey() *key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.signing
+}
+
+// verificationKey returns the key with the given id. Tokens issued before key
+// ids were added have none and are verified with the signing key.
+func (k *KeyRing) verificationKey(id string) (*key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if id == "" {
+		return k.signing, true
+	}
+
+	key, ok := k.verification[id]
+	return key, ok
+}
+
+// algorithms returns the algorithms of the verification keys.
+func (k *KeyRing) algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var algorithms []string
+	for _, key := range k.verification {
+		if !containsString(algorithms, key.method.Alg()) {
+			algorithms = append(algorithms, key.method.Alg())
+		}
+	}
+	return algorithms
+}
+
+// PublicKeys returns every verification key as a JSON Web Key, ordered by id.
+func (k *KeyRing) PublicKeys() []JSONWebKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]JSONWebKey, 0, len(k.verification))
+	for _, key := range k.verification {
+		jwk := publicJWK(key.public)
+		jwk.Use = "sig"
+		jwk.Algorithm = key.method.Alg()
+		jwk.KeyID = key.id
+		keys = append(keys, jwk)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys
+}
+
+// JSONWebKey is a public key in the format of RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// N and E are the members of an RSA key.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the members of an ECDSA or Ed25519 key, Y only of an
+	// ECDSA key.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// publicJWK returns the members of the public key that identify it.
+func publicJWK(public crypto.PublicKey) JSONWebKey {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			KeyType: "RSA",
+			N:       encode(public.N.Bytes()),
+			E:       encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			KeyType: "EC",
+			Curve:   public.Curve.Params().Name,
+			X:       encode(public.X.FillBytes(make([]byte, size))),
+			Y:       encode(public.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encode(public),
+		}
+	}
+
+	return JSONWebKey{}
+}
+
+// keyID returns the RFC 7638 thumbprint of the key, so the id of a key is
+// the same on every instance without having to be configured.
+func keyID(public crypto.PublicKey) string {
+	jwk := publicJWK(public)
+
+	// the required members in lexicographic order without whitespace, which
+	// is how encoding/json marshals a map
+	members := map[string]string{"kty": jwk.KeyType}
+	switch jwk.KeyType {
+	case "RSA":
+		members["n"], members["e"] = jwk.N, jwk.E
+	case "EC":
+		members["crv"], members["x"], members["y"] = jwk.Curve, jwk.X, jwk.Y
+	case "OKP":
+		members["crv"], members["x"] = jwk.Curve, jwk.X
+	}
+	thumbprint, _ := json.Marshal(members)
+
+	sum := sha256.Sum256(thumbprint)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// signingMethod returns the algorithm the key signs with.
+func signingMethod(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, errors.New("only ecdsa keys on the P-256 curve are supported")
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// parseKeys reads every PEM block of the data. Private keys are PKCS1, SEC 1
+// or PKCS8 encoded, public keys PKIX or PKCS1 encoded.
+func parseKeys(data []byte) ([]*key, error) {
+	var keys []*key
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := parseKey(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("failed to read pem block of key")
+	}
+
+	return keys, nil
+}
+
+func parseKey(block *pem.Block) (*key, error) {
+	var (
+		parsed interface{}
+		err    error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s, err: %w", block.Type, err)
+	}
+
+	k := &key{public: parsed}
+	if private, ok := parsed.(crypto.Signer); ok {
+		k.private, k.public = private, private.Public()
+	}
+
+	k.method, err = signingMethod(k.public)
+	if err != nil {
+		return nil, err
+	}
+	k.id = keyID(k.public)
+
+	return k, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
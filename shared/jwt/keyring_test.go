@@ -0,0 +1,219 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return key
+}
+
+// encodeTestKey PEM encodes the private key, or only its public key. RSA
+// private keys are PKCS1 encoded like the keys in etc/jwt, others PKCS8.
+func encodeTestKey(t *testing.T, key crypto.Signer, private bool) []byte {
+	if !private {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		assert.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func writeTestKey(t *testing.T, dir, name string, key crypto.Signer, private bool) {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), encodeTestKey(t, key, private), 0o600))
+}
+
+func TestKeyRing(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		oldKey = newTestKey(t)
+		newKey = newTestKey(t)
+	)
+	writeTestKey(t, dir, signingKeyFile, oldKey, true)
+
+	keys, err := NewKeyRing(DirectoryKeySource{Dir: dir})
+	assert.NoError(t, err)
+
+	oldId := keys.signingKey().id
+	assert.Equal(t, oldKey, keys.signingKey().private)
+	assert.Len(t, keys.PublicKeys(), 1)
+
+	s := &keyRingSigner{keys: keys, options: Options{Issuer: "test-issuer", Audience: "test-audience", AccessTokenTTL: time.Minute}}
+	oldToken, err := s.CreateAccessToken(42, "session", nil, nil)
+	assert.NoError(t, err)
+
+	t.Run("Success Rotate", func(t *testing.T) {
+		// the public key of the new key pair is published first
+		writeTestKey(t, dir, "next.key", newKey, false)
+		assert.NoError(t, keys.Reload())
+		assert.Equal(t, oldKey, keys.signingKey().private)
+		assert.Len(t, keys.PublicKeys(), 2)
+
+		// then the new key signs, while tokens of the old key stay valid
+		writeTestKey(t, dir, "previous.key", oldKey, false)
+		writeTestKey(t, dir, signingKeyFile, newKey, true)
+		assert.NoError(t, os.Remove(filepath.Join(dir, "next.key")))
+		assert.NoError(t, keys.Reload())
+
+		newId := keys.signingKey().id
+		assert.Equal(t, newKey, keys.signingKey().private)
+		assert.NotEqual(t, oldId, newId)
+
+		_, err = s.ParseWithClaims(oldToken)
+		assert.NoError(t, err)
+
+		newToken, err := s.CreateAccessToken(42, "session", nil, nil)
+		assert.NoError(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+		assert.NoError(t, err)
+		assert.Equal(t, newId, parsed.Header["kid"])
+
+		// finally the old key is removed
+		assert.NoError(t, os.Remove(filepath.Join(dir, "previous.key")))
+		assert.NoError(t, keys.Reload())
+		_, err = s.ParseWithClaims(oldToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Invalid File Keeps Keys", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.key"), []byte("not a key"), 0o600))
+		defer os.Remove(filepath.Join(dir, "broken.key"))
+
+		assert.Error(t, keys.Reload())
+		assert.Equal(t, newKey, keys.signingKey().private)
+	})
+
+	t.Run("Failed Public Signing Key", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestKey(t, dir, signingKeyFile, newKey, false)
+
+		_, err := NewKeyRing(DirectoryKeySource{Dir: dir})
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyRing_Algorithms(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	rsaKey := newTestKey(t)
+
+	sec1, err := x509.MarshalECPrivateKey(ecdsaKey)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		pem       []byte
+		algorithm string
+		keyType   string
+	}{
+		{name: "RSA PKCS1", pem: encodeTestKey(t, rsaKey, true), algorithm: "RS256", keyType: "RSA"},
+		{name: "RSA PKCS8", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), algorithm: "RS256", keyType: "RSA"},
+		{name: "ECDSA PKCS8", pem: encodeTestKey(t, ecdsaKey, true), algorithm: "ES256", keyType: "EC"},
+		{name: "ECDSA SEC1", pem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), algorithm: "ES256", keyType: "EC"},
+		{name: "Ed25519", pem: encodeTestKey(t, ed25519Key, true), algorithm: "EdDSA", keyType: "OKP"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_JWT_SIGNING_KEY", string(tt.pem))
+
+			keys, err := NewKeyRing(EnvKeySource{SigningKeyVar: "TEST_JWT_SIGNING_KEY"})
+			assert.NoError(t, err)
+
+			s := &keyRingSigner{keys: keys, options: Options{Issuer: "test-issuer", Audience: "test-audience", AccessTokenTTL: time.Minute}}
+			token, err := s.CreateAccessToken(42, "session", nil, nil)
+			assert.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.algorithm, parsed.Header["alg"])
+
+			claims, err := s.ParseWithClaims(token)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(42), claims.UserId)
+
+			published := keys.PublicKeys()
+			assert.Len(t, published, 1)
+			assert.Equal(t, tt.algorithm, published[0].Algorithm)
+			assert.Equal(t, tt.keyType, published[0].KeyType)
+			assert.Equal(t, keys.signingKey().id, published[0].KeyID)
+		})
+	}
+
+	t.Run("Failed Unsupported Curve", func(t *testing.T) {
+		p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		assert.NoError(t, err)
+
+		_, err = parseKeys(encodeTestKey(t, p384Key, true))
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyRing_PublicKeys(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	writeTestKey(t, dir, signingKeyFile, newTestKey(t), true)
+	writeTestKey(t, dir, "ecdsa.key", ecdsaKey, false)
+
+	keys, err := NewKeyRing(DirectoryKeySource{Dir: dir})
+	assert.NoError(t, err)
+
+	published := keys.PublicKeys()
+	assert.Len(t, published, 2)
+	for _, key := range published {
+		assert.Equal(t, "sig", key.Use)
+
+		switch key.KeyType {
+		case "RSA":
+			assert.Equal(t, keys.signingKey().id, key.KeyID)
+			assert.Equal(t, "RS256", key.Algorithm)
+			assert.Equal(t, "AQAB", key.E)
+		case "EC":
+			assert.Equal(t, "ES256", key.Algorithm)
+			assert.Equal(t, "P-256", key.Curve)
+			assert.Len(t, key.X, 43)
+			assert.Len(t, key.Y, 43)
+		default:
+			t.Errorf("unexpected key type %s", key.KeyType)
+		}
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	// the example of RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	assert.NoError(t, err)
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", keyID(key))
+}
@@ -0,0 +1,149 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeySource provides the PEM encoded keys of a KeyRing. It is read again on
+// every reload of the key ring.
+type KeySource interface {
+	// Load returns the private key new tokens are signed with, and the keys
+	// that are only used to verify tokens.
+	Load() (signingKey []byte, verificationKeys [][]byte, err error)
+}
+
+// signingKeyFile is the name of the file in a key directory holding the
+// private key new tokens are signed with.
+const signingKeyFile = "private.key"
+
+// DirectoryKeySource reads the *.key files of a directory. The key in
+// private.key signs tokens, the keys of every other file verify them.
+type DirectoryKeySource struct {
+	Dir string
+}
+
+func (s DirectoryKeySource) Load() (signingKey []byte, verificationKeys [][]byte, err error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.key"))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		buff, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if filepath.Base(file) == signingKeyFile {
+			signingKey = buff
+			continue
+		}
+		verificationKeys = append(verificationKeys, buff)
+	}
+
+	if signingKey == nil {
+		return nil, nil, fmt.Errorf("no signing key found at %s", filepath.Join(s.Dir, signingKeyFile))
+	}
+
+	return
+}
+
+// FileKeySource reads the keys from the given files.
+type FileKeySource struct {
+	SigningKeyFile       string
+	VerificationKeyFiles []string
+}
+
+func (s FileKeySource) Load() (signingKey []byte, verificationKeys [][]byte, err error) {
+	signingKey, err = os.ReadFile(s.SigningKeyFile)
+	if err != nil {
+		return
+	}
+
+	for _, file := range s.VerificationKeyFiles {
+		buff, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		verificationKeys = append(verificationKeys, buff)
+	}
+
+	return
+}
+
+// EnvKeySource reads the keys from environment variables, either PEM encoded
+// or base64 encoded PEM for environments that do not keep line breaks. The
+// verification keys variable may hold several PEM blocks.
+type EnvKeySource struct {
+	SigningKeyVar       string
+	VerificationKeysVar string
+}
+
+func (s EnvKeySource) Load() (signingKey []byte, verificationKeys [][]byte, err error) {
+	signingKey, err = decodeEnvKey(s.SigningKeyVar)
+	if err != nil {
+		return
+	}
+	if len(signingKey) == 0 {
+		return nil, nil, fmt.Errorf("no signing key found in %s", s.SigningKeyVar)
+	}
+
+	if s.VerificationKeysVar != "" {
+		keys, err := decodeEnvKey(s.VerificationKeysVar)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(keys) > 0 {
+			verificationKeys = append(verificationKeys, keys)
+		}
+	}
+
+	return
+}
+
+func decodeEnvKey(name string) ([]byte, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" || strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither pem nor base64 encoded, err: %w", name, err)
+	}
+	return decoded, nil
+}
+
+// KeySourceFromEnv chooses the key source by the variables that are set:
+//   - JWT_SIGNING_KEY and JWT_VERIFICATION_KEYS hold the keys themselves,
+//   - JWT_SIGNING_KEY_FILE and JWT_VERIFICATION_KEY_FILES, a comma separated
+//     list, name the files holding them,
+//   - JWT_KEY_DIR names a directory, see DirectoryKeySource.
+//
+// Without any of them the keys are read from etc/jwt of the working directory.
+func KeySourceFromEnv() KeySource {
+	if os.Getenv("JWT_SIGNING_KEY") != "" {
+		return EnvKeySource{SigningKeyVar: "JWT_SIGNING_KEY", VerificationKeysVar: "JWT_VERIFICATION_KEYS"}
+	}
+
+	if file := os.Getenv("JWT_SIGNING_KEY_FILE"); file != "" {
+		source := FileKeySource{SigningKeyFile: file}
+		for _, file := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				source.VerificationKeyFiles = append(source.VerificationKeyFiles, file)
+			}
+		}
+		return source
+	}
+
+	if dir := os.Getenv("JWT_KEY_DIR"); dir != "" {
+		return DirectoryKeySource{Dir: dir}
+	}
+
+	workDir, _ := os.Getwd()
+	return DirectoryKeySource{Dir: filepath.Join(workDir, "etc", "jwt")}
+}
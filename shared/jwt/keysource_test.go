@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvKeySource(t *testing.T) {
+	var (
+		signingKey      = encodeTestKey(t, newTestKey(t), true)
+		verificationKey = encodeTestKey(t, newTestKey(t), false)
+		source          = EnvKeySource{SigningKeyVar: "TEST_JWT_SIGNING_KEY", VerificationKeysVar: "TEST_JWT_VERIFICATION_KEYS"}
+	)
+
+	t.Run("Success PEM", func(t *testing.T) {
+		t.Setenv("TEST_JWT_SIGNING_KEY", string(signingKey))
+		t.Setenv("TEST_JWT_VERIFICATION_KEYS", string(verificationKey))
+
+		signing, verification, err := source.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, bytes.TrimSpace(signingKey), signing)
+		assert.Equal(t, [][]byte{bytes.TrimSpace(verificationKey)}, verification)
+	})
+
+	t.Run("Success Base64", func(t *testing.T) {
+		t.Setenv("TEST_JWT_SIGNING_KEY", base64.StdEncoding.EncodeToString(signingKey))
+		t.Setenv("TEST_JWT_VERIFICATION_KEYS", "")
+
+		signing, verification, err := source.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, signingKey, signing)
+		assert.Empty(t, verification)
+	})
+
+	t.Run("Failed Not Set", func(t *testing.T) {
+		t.Setenv("TEST_JWT_SIGNING_KEY", "")
+
+		_, _, err := source.Load()
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed Not Encoded", func(t *testing.T) {
+		t.Setenv("TEST_JWT_SIGNING_KEY", "not a key!")
+
+		_, _, err := source.Load()
+		assert.Error(t, err)
+	})
+}
+
+func TestFileKeySource(t *testing.T) {
+	var (
+		dir             = t.TempDir()
+		signingKey      = encodeTestKey(t, newTestKey(t), true)
+		verificationKey = encodeTestKey(t, newTestKey(t), false)
+	)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "signing.pem"), signingKey, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "verification.pem"), verificationKey, 0o600))
+
+	signing, verification, err := FileKeySource{
+		SigningKeyFile:       filepath.Join(dir, "signing.pem"),
+		VerificationKeyFiles: []string{filepath.Join(dir, "verification.pem")},
+	}.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, signingKey, signing)
+	assert.Equal(t, [][]byte{verificationKey}, verification)
+
+	_, _, err = FileKeySource{SigningKeyFile: filepath.Join(dir, "missing.pem")}.Load()
+	assert.Error(t, err)
+}
+
+func TestDirectoryKeySource(t *testing.T) {
+	_, _, err := DirectoryKeySource{Dir: t.TempDir()}.Load()
+	assert.Error(t, err)
+}
+
+func TestKeySourceFromEnv(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEY", "")
+	t.Setenv("JWT_SIGNING_KEY_FILE", "")
+	t.Setenv("JWT_KEY_DIR", "")
+
+	workDir, _ := os.Getwd()
+	assert.Equal(t, DirectoryKeySource{Dir: filepath.Join(workDir, "etc", "jwt")}, KeySourceFromEnv())
+
+	t.Setenv("JWT_KEY_DIR", "/keys")
+	assert.Equal(t, DirectoryKeySource{Dir: "/keys"}, KeySourceFromEnv())
+
+	t.Setenv("JWT_SIGNING_KEY_FILE", "/keys/signing.pem")
+	t.Setenv("JWT_VERIFICATION_KEY_FILES", "/keys/a.pem, /keys/b.pem")
+	assert.Equal(t, FileKeySource{
+		SigningKeyFile:       "/keys/signing.pem",
+		VerificationKeyFiles: []string{"/keys/a.pem", "/keys/b.pem"},
+	}, KeySourceFromEnv())
+
+	t.Setenv("JWT_SIGNING_KEY", "pem")
+	assert.Equal(t, EnvKeySource{SigningKeyVar: "JWT_SIGNING_KEY", VerificationKeysVar: "JWT_VERIFICATION_KEYS"}, KeySourceFromEnv())
+}
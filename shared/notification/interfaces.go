@@ -0,0 +1,10 @@
+package notification
+
+import "context"
+
+//go:generate mockgen -source=./interfaces.go -destination=./interfaces.mock.gen.go -package=notification
+
+// SMSSender delivers a text message to an E.164 formatted phone number.
+type SMSSender interface {
+	SendSMS(ctx context.Context, phoneNumber, message string) error
+}
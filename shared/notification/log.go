@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type logSMSSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogSMSSender returns a SMSSender that writes every message to w instead
+// of delivering it, to be used for local development and testing.
+func NewLogSMSSender(w io.Writer) SMSSender {
+	return &logSMSSender{w: w}
+}
+
+func (l *logSMSSender) SendSMS(_ context.Context, phoneNumber, message string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "%s [sms] to=%s message=%q\n", time.Now().Format(time.RFC3339), phoneNumber, message)
+	return err
+}
@@ -0,0 +1,206 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// legacyCost is the bcrypt cost the legacy hashes were created with.
+const legacyCost = bcrypt.DefaultCost
+
+var (
+	ErrInvalidHash   = errors.New("password hash is not in a supported format")
+	ErrInvalidParams = errors.New("invalid argon2id parameters")
+)
+
+// Argon2idParams are the tunable cost parameters of Argon2id, see RFC 9106.
+type Argon2idParams struct {
+	// Memory is the amount of memory used in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Validate reports whether argon2.IDKey can derive keys with the parameters
+// and whether they are not too weak to be used at all.
+func (p Argon2idParams) Validate() error {
+	switch {
+	case p.Iterations < 1:
+		return fmt.Errorf("%w: iterations must be at least 1", ErrInvalidParams)
+	case p.Parallelism < 1:
+		return fmt.Errorf("%w: parallelism must be between 1 and 255", ErrInvalidParams)
+	case p.Memory < 8*uint32(p.Parallelism):
+		return fmt.Errorf("%w: memory must be at least 8 KiB per lane", ErrInvalidParams)
+	case p.SaltLength < 8:
+		return fmt.Errorf("%w: salt length must be at least 8 bytes", ErrInvalidParams)
+	case p.KeyLength < 16:
+		return fmt.Errorf("%w: key length must be at least 16 bytes", ErrInvalidParams)
+	}
+	return nil
+}
+
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Hasher hashes passwords with Argon2id into self-describing PHC strings,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>. It still verifies the
+// legacy format, a hex encoded bcrypt digest of "password:salt" where the
+// salt is stored separately, so existing users can be migrated on login.
+type Hasher struct {
+	params Argon2idParams
+
+	dummyOnce       sync.Once
+	dummyHash       string
+	dummyLegacyHash []byte
+}
+
+// NewHasher returns an error when the parameters are invalid, see
+// Argon2idParams.Validate.
+func NewHasher(params Argon2idParams) (*Hasher, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &Hasher{params: params}, nil
+}
+
+// DefaultHasher returns a Hasher with DefaultArgon2idParams.
+func DefaultHasher() *Hasher {
+	h, _ := NewHasher(DefaultArgon2idParams())
+	return h
+}
+
+// Hash returns the PHC string of the password using the current parameters.
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism,
+		h.params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether the password matches the encoded hash. legacySalt
+// is only used for legacy bcrypt hashes. needsRehash is true when the hash
+// matches but is in the legacy format or uses outdated parameters.
+//
+// Every call costs one Argon2id and one bcrypt comparison, whichever format
+// the hash is in, so the response time does not tell legacy accounts apart
+// from the others or from unknown users verified against DummyHash.
+func (h *Hasher) Verify(password, encoded, legacySalt string) (match, needsRehash bool, err error) {
+	h.initDummy()
+
+	if !strings.HasPrefix(encoded, argon2idPrefix) {
+		_, _, _ = h.verifyArgon2id(password, h.dummyHash)
+		match, err = verifyLegacy(password, encoded, legacySalt)
+		return match, match, err
+	}
+
+	_ = bcrypt.CompareHashAndPassword(h.dummyLegacyHash, []byte(password+":"))
+	return h.verifyArgon2id(password, encoded)
+}
+
+func (h *Hasher) verifyArgon2id(password, encoded string) (match, needsRehash bool, err error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism,
+		params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != h.params, nil
+}
+
+// DummyHash returns a valid hash that never matches a real password. It is
+// verified against when a user does not exist, so a failed login costs the
+// same regardless of whether the user is known.
+func (h *Hasher) DummyHash() string {
+	h.initDummy()
+	return h.dummyHash
+}
+
+func (h *Hasher) initDummy() {
+	h.dummyOnce.Do(func() {
+		h.dummyHash, _ = h.Hash("dummy password")
+		h.dummyLegacyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password:"), legacyCost)
+	})
+}
+
+func verifyLegacy(password, encoded, salt string) (bool, error) {
+	hashed, err := hex.DecodeString(encoded)
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashed, []byte(password+":"+salt))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	return true, nil
+}
+
+func decodeArgon2id(encoded string) (params Argon2idParams, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations < 1 || params.Parallelism < 1 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
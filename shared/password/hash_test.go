@@ -0,0 +1,104 @@
+package password
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+var testParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestNewHasher(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		hasher, err := NewHasher(testParams)
+		assert.NoError(t, err)
+		assert.NotNil(t, hasher)
+	})
+
+	invalid := map[string]func(p *Argon2idParams){
+		"Zero Iterations":   func(p *Argon2idParams) { p.Iterations = 0 },
+		"Zero Parallelism":  func(p *Argon2idParams) { p.Parallelism = 0 },
+		"Too Little Memory": func(p *Argon2idParams) { p.Memory, p.Parallelism = 31, 4 },
+		"Short Salt":        func(p *Argon2idParams) { p.SaltLength = 4 },
+		"Short Key":         func(p *Argon2idParams) { p.KeyLength = 8 },
+	}
+	for name, modify := range invalid {
+		t.Run("Failed "+name, func(t *testing.T) {
+			params := testParams
+			modify(&params)
+
+			hasher, err := NewHasher(params)
+			assert.ErrorIs(t, err, ErrInvalidParams)
+			assert.Nil(t, hasher)
+		})
+	}
+}
+
+func TestHasher_Verify(t *testing.T) {
+	hasher, err := NewHasher(testParams)
+	assert.NoError(t, err)
+
+	t.Run("Argon2id", func(t *testing.T) {
+		encoded, err := hasher.Hash("kebun sawit")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+		match, needsRehash, err := hasher.Verify("kebun sawit", encoded, "")
+		assert.NoError(t, err)
+		assert.True(t, match)
+		assert.False(t, needsRehash)
+
+		match, _, err = hasher.Verify("kebun sawit!", encoded, "")
+		assert.NoError(t, err)
+		assert.False(t, match)
+	})
+
+	t.Run("Argon2id Outdated Params", func(t *testing.T) {
+		encoded, err := hasher.Hash("kebun sawit")
+		assert.NoError(t, err)
+
+		stronger := testParams
+		stronger.Iterations = 2
+		strongerHasher, err := NewHasher(stronger)
+		assert.NoError(t, err)
+		match, needsRehash, err := strongerHasher.Verify("kebun sawit", encoded, "")
+		assert.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("Legacy Bcrypt", func(t *testing.T) {
+		hashed, err := bcrypt.GenerateFromPassword([]byte("kebun sawit:salt"), bcrypt.MinCost)
+		assert.NoError(t, err)
+		encoded := hex.EncodeToString(hashed)
+
+		match, needsRehash, err := hasher.Verify("kebun sawit", encoded, "salt")
+		assert.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, needsRehash)
+
+		match, needsRehash, err = hasher.Verify("kebun sawit", encoded, "other salt")
+		assert.NoError(t, err)
+		assert.False(t, match)
+		assert.False(t, needsRehash)
+	})
+
+	t.Run("Invalid Hash", func(t *testing.T) {
+		_, _, err := hasher.Verify("kebun sawit", "$argon2id$v=19$m=1024$salt", "")
+		assert.ErrorIs(t, err, ErrInvalidHash)
+
+		_, _, err = hasher.Verify("kebun sawit", "not hex", "")
+		assert.ErrorIs(t, err, ErrInvalidHash)
+
+		_, _, err = hasher.Verify("kebun sawit", "$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$a2V5", "")
+		assert.ErrorIs(t, err, ErrInvalidHash)
+	})
+
+	t.Run("Dummy Hash", func(t *testing.T) {
+		match, _, err := hasher.Verify("", hasher.DummyHash(), "")
+		assert.NoError(t, err)
+		assert.False(t, match)
+	})
+}
@@ -0,0 +1,125 @@
+package password
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = func() map[string]struct{} {
+	passwords := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return passwords
+}()
+
+// Policy describes the rules a password has to follow.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// ForbidCommon rejects passwords found in the bundled list of common passwords.
+	ForbidCommon bool
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:    8,
+		MaxLength:    64,
+		RequireLower: true,
+		RequireDigit: true,
+		ForbidCommon: true,
+	}
+}
+
+// Validate returns a message for every rule the password breaks, or nil when
+// the password is valid. personalInfo, such as the phone number or the full
+// name of the user, must not appear in the password.
+func (p Policy) Validate(password string, personalInfo ...string) (violations []string) {
+	length := len([]rune(password))
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	if p.ForbidCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			violations = append(violations, "is too common")
+		}
+	}
+
+	for _, info := range forbiddenSubstrings(personalInfo) {
+		if strings.Contains(lower, info) {
+			violations = append(violations, "must not contain your phone number or name")
+			break
+		}
+	}
+
+	return violations
+}
+
+// forbiddenSubstrings splits the personal information into the lowercase
+// parts a password must not contain. Parts shorter than 3 characters are
+// skipped as they would reject too many passwords.
+func forbiddenSubstrings(personalInfo []string) (substrings []string) {
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+
+		// phone numbers in E.164 are matched without the "+", pass the
+		// national number as well to match it without the calling code
+		if strings.HasPrefix(info, "+") {
+			substrings = append(substrings, strings.TrimPrefix(info, "+"))
+			continue
+		}
+
+		substrings = append(substrings, info)
+		substrings = append(substrings, strings.Fields(info)...)
+	}
+
+	filtered := substrings[:0]
+	for _, substring := range substrings {
+		if len(substring) >= 3 {
+			filtered = append(filtered, substring)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,60 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	policy := Policy{
+		MinLength:     8,
+		MaxLength:     16,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		ForbidCommon:  true,
+	}
+
+	tests := []struct {
+		name         string
+		password     string
+		personalInfo []string
+		violations   []string
+	}{
+		{name: "Valid", password: "Kebun#Sawit9", personalInfo: []string{"+62811111111", "Sulaiman Pro"}},
+		{name: "Too Short", password: "Ab1#", violations: []string{"must be at least 8 characters"}},
+		{name: "Too Long", password: "Abcdefgh1#abcdefg", violations: []string{"must be at most 16 characters"}},
+		{
+			name:       "Missing Classes",
+			password:   "abcdefghij",
+			violations: []string{"must contain an uppercase letter", "must contain a digit", "must contain a symbol"},
+		},
+		{name: "Common", password: "P@ssw0rd", violations: []string{"is too common"}},
+		{
+			name:         "Contains Phone Number",
+			password:     "Ab#62811111111",
+			personalInfo: []string{"+62811111111"},
+			violations:   []string{"must not contain your phone number or name"},
+		},
+		{
+			name:         "Contains National Phone Number",
+			password:     "Ab#811111111",
+			personalInfo: []string{"+62811111111", "811111111"},
+			violations:   []string{"must not contain your phone number or name"},
+		},
+		{
+			name:         "Contains Name",
+			password:     "Sulaiman#2024",
+			personalInfo: []string{"+62811111111", "Sulaiman Pro"},
+			violations:   []string{"must not contain your phone number or name"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.violations, policy.Validate(tt.password, tt.personalInfo...))
+		})
+	}
+}
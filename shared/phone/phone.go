@@ -0,0 +1,232 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrEmpty              = errors.New("is required")
+	ErrInvalidCharacters  = errors.New("must only contain digits, spaces, dashes, dots and parentheses after an optional +")
+	ErrCountryNotAllowed  = errors.New("has a country calling code that is not supported")
+	ErrInvalidLength      = errors.New("has an invalid number of digits")
+	ErrMissingTrunkPrefix = errors.New("must start with + and the country calling code, or with the trunk prefix of a local number")
+	errUnknownCountryCode = errors.New("unknown country")
+)
+
+// Country is the part of a national numbering plan needed to normalize phone
+// numbers of that country to E.164.
+type Country struct {
+	// Code is the ISO 3166-1 alpha-2 code of the country, e.g. "ID".
+	Code string
+	// CallingCode is the country calling code without the leading "+".
+	CallingCode string
+	// TrunkPrefix is dialed before a number from within the country, e.g.
+	// the "0" of "0812...". It is not part of the E.164 number.
+	TrunkPrefix string
+	// MinLength and MaxLength bound the digits of the national significant
+	// number, i.e. without calling code and trunk prefix.
+	MinLength int
+	MaxLength int
+}
+
+var countries = map[string]Country{
+	"AU": {Code: "AU", CallingCode: "61", TrunkPrefix: "0", MinLength: 9, MaxLength: 9},
+	"GB": {Code: "GB", CallingCode: "44", TrunkPrefix: "0", MinLength: 9, MaxLength: 10},
+	"ID": {Code: "ID", CallingCode: "62", TrunkPrefix: "0", MinLength: 8, MaxLength: 12},
+	"IN": {Code: "IN", CallingCode: "91", TrunkPrefix: "0", MinLength: 10, MaxLength: 10},
+	"MY": {Code: "MY", CallingCode: "60", TrunkPrefix: "0", MinLength: 8, MaxLength: 10},
+	"PH": {Code: "PH", CallingCode: "63", TrunkPrefix: "0", MinLength: 8, MaxLength: 10},
+	"SG": {Code: "SG", CallingCode: "65", MinLength: 8, MaxLength: 8},
+	"TH": {Code: "TH", CallingCode: "66", TrunkPrefix: "0", MinLength: 8, MaxLength: 9},
+	// the "1" dialed before US numbers is the calling code itself, a local
+	// number is written without it
+	"US": {Code: "US", CallingCode: "1", MinLength: 10, MaxLength: 10},
+	"VN": {Code: "VN", CallingCode: "84", TrunkPrefix: "0", MinLength: 9, MaxLength: 10},
+}
+
+// LookupCountry returns the numbering plan of the given ISO 3166-1 alpha-2
+// country code.
+func LookupCountry(code string) (Country, bool) {
+	country, ok := countries[strings.ToUpper(strings.TrimSpace(code))]
+	return country, ok
+}
+
+// Parser normalizes phone numbers of a set of allowed countries to E.164.
+type Parser struct {
+	defaultCountry Country
+	// allowed is ordered by descending calling code length, so that the
+	// longest matching calling code wins.
+	allowed []Country
+}
+
+// NewParser returns a parser accepting numbers of the allowed countries.
+// Numbers without a country calling code are read as numbers of the default
+// country, which is always allowed.
+func NewParser(defaultCountry string, allowedCountries ...string) (*Parser, error) {
+	country, ok := LookupCountry(defaultCountry)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownCountryCode, defaultCountry)
+	}
+
+	p := &Parser{defaultCountry: country, allowed: []Country{country}}
+	for _, code := range allowedCountries {
+		allowed, ok := LookupCountry(code)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", errUnknownCountryCode, code)
+		}
+		if !p.isAllowed(allowed.Code) {
+			p.allowed = append(p.allowed, allowed)
+		}
+	}
+	sort.SliceStable(p.allowed, func(i, j int) bool {
+		return len(p.allowed[i].CallingCode) > len(p.allowed[j].CallingCode)
+	})
+
+	return p, nil
+}
+
+// DefaultParser only accepts Indonesian numbers.
+func DefaultParser() *Parser {
+	p, _ := NewParser("ID")
+	return p
+}
+
+// Normalize parses a phone number in local ("0812-3456-789") or
+// international ("+62 812 3456 789", "0062812...") format and returns it in
+// E.164 format ("+628123456789").
+func (p *Parser) Normalize(phoneNumber string) (string, error) {
+	country, number, err := p.parse(phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	return "+" + country.CallingCode + number, nil
+}
+
+// NationalNumber parses a phone number like Normalize, but returns the
+// national significant number, i.e. without calling code and trunk prefix
+// ("8123456789").
+func (p *Parser) NationalNumber(phoneNumber string) (string, error) {
+	_, number, err := p.parse(phoneNumber)
+	return number, err
+}
+
+// NormalizePrefix converts the start of a phone number, e.g. a search term,
+// to the start of the E.164 numbers it matches. A local prefix ("0812") gets
+// the calling code of the default country, any other is read as an
+// international one, with or without the "+" ("+6281", "6281", "006281").
+func (p *Parser) NormalizePrefix(prefix string) (string, error) {
+	prefix = strings.TrimPrefix(strings.TrimSpace(prefix), "+")
+
+	var digits strings.Builder
+	for _, r := range prefix {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidCharacters
+		}
+	}
+	prefix = digits.String()
+
+	country := p.defaultCountry
+	switch {
+	case strings.HasPrefix(prefix, "00"):
+		prefix = prefix[2:]
+	case country.TrunkPrefix != "" && strings.HasPrefix(prefix, country.TrunkPrefix):
+		prefix = country.CallingCode + prefix[len(country.TrunkPrefix):]
+	}
+
+	return "+" + prefix, nil
+}
+
+func (p *Parser) parse(phoneNumber string) (Country, string, error) {
+	number := strings.TrimSpace(phoneNumber)
+	if number == "" {
+		return Country{}, "", ErrEmpty
+	}
+
+	international := strings.HasPrefix(number, "+")
+	number = strings.TrimPrefix(number, "+")
+
+	var digits strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return Country{}, "", ErrInvalidCharacters
+		}
+	}
+	number = digits.String()
+
+	// 00 is the international call prefix used by most countries
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	country := p.defaultCountry
+	switch {
+	case international:
+		var ok bool
+		country, ok = p.countryOf(number)
+		if !ok {
+			return Country{}, "", ErrCountryNotAllowed
+		}
+		number = number[len(country.CallingCode):]
+	case country.TrunkPrefix != "" && strings.HasPrefix(number, country.TrunkPrefix):
+		number = number[len(country.TrunkPrefix):]
+	case strings.HasPrefix(number, country.CallingCode) &&
+		(country.TrunkPrefix != "" || len(number) > country.MaxLength):
+		// an international number of the default country with the "+" left
+		// out, as in "628123456789". A local number cannot be read this way,
+		// it starts with the trunk prefix or is too short to have one.
+		international = true
+		number = number[len(country.CallingCode):]
+	case country.TrunkPrefix != "":
+		return Country{}, "", ErrMissingTrunkPrefix
+	}
+
+	// the trunk prefix is also stripped after a calling code, as in
+	// "+62 0812...", a common way of writing numbers
+	if international && country.TrunkPrefix != "" {
+		number = strings.TrimPrefix(number, country.TrunkPrefix)
+	}
+
+	if len(number) < country.MinLength || len(number) > country.MaxLength {
+		return Country{}, "", fmt.Errorf("%w, %s numbers have %s digits after the country calling code",
+			ErrInvalidLength, country.Code, lengthRange(country))
+	}
+
+	return country, number, nil
+}
+
+func (p *Parser) countryOf(number string) (Country, bool) {
+	for _, country := range p.allowed {
+		if strings.HasPrefix(number, country.CallingCode) {
+			return country, true
+		}
+	}
+	return Country{}, false
+}
+
+func (p *Parser) isAllowed(code string) bool {
+	for _, country := range p.allowed {
+		if country.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func lengthRange(country Country) string {
+	if country.MinLength == country.MaxLength {
+		return fmt.Sprint(country.MinLength)
+	}
+	return fmt.Sprintf("%d to %d", country.MinLength, country.MaxLength)
+}
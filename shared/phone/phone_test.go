@@ -0,0 +1,124 @@
+package phone
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParser_Normalize(t *testing.T) {
+	parser, err := NewParser("ID", "MY", "SG", "US")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		phoneNumber string
+		normalized  string
+		err         error
+	}{
+		{name: "E.164", phoneNumber: "+628123456789", normalized: "+628123456789"},
+		{name: "Local", phoneNumber: "08123456789", normalized: "+628123456789"},
+		{name: "Calling Code Without Plus", phoneNumber: "628123456789", normalized: "+628123456789"},
+		{name: "Calling Code Without Plus And Trunk Prefix", phoneNumber: "62 0812 3456 789", normalized: "+628123456789"},
+		{name: "Formatted", phoneNumber: " +62 (812) 3456-789 ", normalized: "+628123456789"},
+		{name: "Trunk Prefix After Calling Code", phoneNumber: "+62 0812 3456 789", normalized: "+628123456789"},
+		{name: "International Call Prefix", phoneNumber: "00628123456789", normalized: "+628123456789"},
+		{name: "Other Allowed Country", phoneNumber: "+65 9123 4567", normalized: "+6591234567"},
+		{name: "Single Digit Calling Code", phoneNumber: "+1 (212) 555-0100", normalized: "+12125550100"},
+		{name: "Empty", phoneNumber: " ", err: ErrEmpty},
+		{name: "Local Without Trunk Prefix", phoneNumber: "8123456789", err: ErrMissingTrunkPrefix},
+		{name: "Letters", phoneNumber: "+62abc", err: ErrInvalidCharacters},
+		{name: "Plus In The Middle", phoneNumber: "0812+3456789", err: ErrInvalidCharacters},
+		{name: "Country Not Allowed", phoneNumber: "+44 20 7946 0958", err: ErrCountryNotAllowed},
+		{name: "Too Short", phoneNumber: "+6232131", err: ErrInvalidLength},
+		{name: "Too Long", phoneNumber: "+628123456789012", err: ErrInvalidLength},
+		{name: "Too Short For Other Country", phoneNumber: "+65 9123 456", err: ErrInvalidLength},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := parser.Normalize(tt.phoneNumber)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.normalized, normalized)
+		})
+	}
+}
+
+func TestParser_Normalize_WithoutTrunkPrefix(t *testing.T) {
+	parser, err := NewParser("SG")
+	assert.NoError(t, err)
+
+	normalized, err := parser.Normalize("9123 4567")
+	assert.NoError(t, err)
+	assert.Equal(t, "+6591234567", normalized)
+
+	normalized, err = parser.Normalize("6591234567")
+	assert.NoError(t, err)
+	assert.Equal(t, "+6591234567", normalized)
+
+	parser, err = NewParser("US")
+	assert.NoError(t, err)
+
+	normalized, err = parser.Normalize("(212) 555-0100")
+	assert.NoError(t, err)
+	assert.Equal(t, "+12125550100", normalized)
+
+	normalized, err = parser.Normalize("1 212 555 0100")
+	assert.NoError(t, err)
+	assert.Equal(t, "+12125550100", normalized)
+}
+
+func TestParser_NationalNumber(t *testing.T) {
+	parser, err := NewParser("ID", "US")
+	assert.NoError(t, err)
+
+	national, err := parser.NationalNumber("+628123456789")
+	assert.NoError(t, err)
+	assert.Equal(t, "8123456789", national)
+
+	national, err = parser.NationalNumber("+12125550100")
+	assert.NoError(t, err)
+	assert.Equal(t, "2125550100", national)
+
+	_, err = parser.NationalNumber("+6232131")
+	assert.ErrorIs(t, err, ErrInvalidLength)
+}
+
+func TestParser_NormalizePrefix(t *testing.T) {
+	parser, err := NewParser("ID")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		prefix     string
+		normalized string
+		err        error
+	}{
+		{name: "E.164", prefix: "+6281", normalized: "+6281"},
+		{name: "Plus Decoded As Space", prefix: " 6281", normalized: "+6281"},
+		{name: "Local", prefix: "0812", normalized: "+62812"},
+		{name: "Formatted", prefix: "0812-34", normalized: "+6281234"},
+		{name: "International Call Prefix", prefix: "006281", normalized: "+6281"},
+		{name: "Trunk Prefix Only", prefix: "0", normalized: "+62"},
+		{name: "Letters", prefix: "08a", err: ErrInvalidCharacters},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := parser.NormalizePrefix(tt.prefix)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.normalized, normalized)
+		})
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	_, err := NewParser("XX")
+	assert.Error(t, err)
+
+	_, err = NewParser("ID", "MY", "XX")
+	assert.Error(t, err)
+
+	parser, err := NewParser("id", "ID", "my")
+	assert.NoError(t, err)
+	assert.Len(t, parser.allowed, 2)
+}
@@ -0,0 +1,38 @@
+package revocation
+
+import (
+	"context"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"time"
+)
+
+// Store keeps track of access tokens that were revoked before they expired.
+// Entries only need to live until the revoked tokens expire, after which
+// Prune may drop them.
+type Store interface {
+	// RevokeToken revokes the single token identified by its jti claim, or
+	// every token of a session when given its sid claim. Every token of a
+	// user is revoked by revoking each of the user's sessions.
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error)
+	Prune(ctx context.Context, now time.Time) error
+}
+
+// StartPruning prunes the store every interval until ctx is done.
+func StartPruning(ctx context.Context, store Store, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := store.Prune(ctx, now); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package revocation
+
+import (
+	"context"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+}
+
+// NewMemoryStore returns a Store that lives in the process memory. It is only
+// suitable for a single instance deployment and for tests.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		tokens: map[string]time.Time{},
+	}
+}
+
+func (m *memoryStore) RevokeToken(_ context.Context, id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[id] = expiresAt
+	return nil
+}
+
+func (m *memoryStore) IsRevoked(_ context.Context, claims *jwt.Claims) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, id := range []string{claims.ID, claims.SessionId} {
+		if expiresAt, ok := m.tokens[id]; ok && id != "" && expiresAt.After(now) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryStore) Prune(_ context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for jti, expiresAt := range m.tokens {
+		if !expiresAt.After(now) {
+			delete(m.tokens, jti)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package revocation
+
+import (
+	"context"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	jwtv4 "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newClaims(userId int64, id, sessionId string, issuedAt time.Time) *jwt.Claims {
+	return &jwt.Claims{
+		RegisteredClaims: jwtv4.RegisteredClaims{ID: id, IssuedAt: jwtv4.NewNumericDate(issuedAt)},
+		UserId:           userId,
+		SessionId:        sessionId,
+	}
+}
+
+func TestMemoryStore_RevokeToken(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = NewMemoryStore()
+		now   = time.Now()
+	)
+
+	assert.NoError(t, store.RevokeToken(ctx, "token-1", now.Add(time.Minute)))
+	assert.NoError(t, store.RevokeToken(ctx, "session-1", now.Add(time.Minute)))
+	assert.NoError(t, store.RevokeToken(ctx, "token-expired", now.Add(-time.Minute)))
+
+	t.Run("Success Token", func(t *testing.T) {
+		revoked, err := store.IsRevoked(ctx, newClaims(1, "token-1", "session-2", now))
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("Success Session", func(t *testing.T) {
+		revoked, err := store.IsRevoked(ctx, newClaims(1, "token-2", "session-1", now))
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("Success Not Revoked", func(t *testing.T) {
+		revoked, err := store.IsRevoked(ctx, newClaims(1, "token-2", "", now))
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Success Expired Entry", func(t *testing.T) {
+		revoked, err := store.IsRevoked(ctx, newClaims(1, "token-expired", "", now))
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = NewMemoryStore().(*memoryStore)
+		now   = time.Now()
+	)
+
+	assert.NoError(t, store.RevokeToken(ctx, "token-1", now.Add(-time.Second)))
+	assert.NoError(t, store.RevokeToken(ctx, "token-2", now.Add(time.Minute)))
+
+	assert.NoError(t, store.Prune(ctx, now))
+	assert.Len(t, store.tokens, 1)
+	assert.Contains(t, store.tokens, "token-2")
+}
@@ -0,0 +1,43 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
+	"time"
+)
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore returns a Store backed by the revoked_tokens table, shared
+// by every instance of the service.
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{db: db}
+}
+
+func (p *postgresStore) RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	var (
+		query = "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING"
+		args  = []any{id, expiresAt}
+	)
+
+	_, err := p.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *postgresStore) IsRevoked(ctx context.Context, claims *jwt.Claims) (revoked bool, err error) {
+	var (
+		query = "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti IN ($1, $2) AND expires_at > now())"
+		args  = []any{claims.ID, claims.SessionId}
+	)
+
+	err = p.db.QueryRowContext(ctx, query, args...).Scan(&revoked)
+	return
+}
+
+func (p *postgresStore) Prune(ctx context.Context, now time.Time) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at <= $1", now)
+	return err
+}
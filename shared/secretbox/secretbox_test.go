@@ -0,0 +1,37 @@
+package secretbox
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBox(t *testing.T) {
+	box, err := New(bytes.Repeat([]byte{1}, KeyLength))
+	assert.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"))
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+
+	plaintext, err := box.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("JBSWY3DPEHPK3PXP"), plaintext)
+
+	again, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	other, err := New(bytes.Repeat([]byte{2}, KeyLength))
+	assert.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = box.Open("not base64!")
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New([]byte("too short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"context"
+	"github.com/SawitProRecruitment/UserService/shared/jwt"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -18,3 +19,12 @@ func GetUserIDFromContext(ctx context.Context) (int64, error) {
 
 	return userId, nil
 }
+
+func GetClaimsFromContext(ctx context.Context) (*jwt.Claims, error) {
+	claims, ok := ctx.Value("Claims").(*jwt.Claims)
+	if !ok || claims == nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "user are not logged in")
+	}
+
+	return claims, nil
+}
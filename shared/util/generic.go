@@ -8,3 +8,13 @@ func In[T comparable](obj T, compared ...T) bool {
 	}
 	return false
 }
+
+// NilIfZero returns a pointer to the value, or nil for the zero value, e.g.
+// for optional fields of a response.
+func NilIfZero[T comparable](value T) *T {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	return &value
+}
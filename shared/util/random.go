@@ -1,53 +1,55 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-	"errors"
-	"golang.org/x/crypto/bcrypt"
-	"os"
-	"strings"
+	"math/big"
 )
 
-func RandomSalt() string {
-	salt := make([]byte, 16)
+// RandomToken returns an url-safe opaque token made of n random bytes.
+func RandomToken(n int) (string, error) {
+	token := make([]byte, n)
 
-	if os.Getenv("TEST") == "TRUE" {
-		return "saltedtest"
-	}
-
-	_, err := rand.Read(salt)
+	_, err := rand.Read(token)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
-	return hex.EncodeToString(salt)
+	return base64.RawURLEncoding.EncodeToString(token), nil
 }
 
-func HashPassword(s string) string {
-	if os.Getenv("TEST") == "TRUE" {
-		return "hashedpassworduser123123123"
-	}
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
-	if err != nil {
-		return ""
+// RandomDigits returns a numeric code of n digits, e.g. for one-time codes
+// that are typed in by hand.
+func RandomDigits(n int) (string, error) {
+	digits := make([]byte, n)
+
+	for i := range digits {
+		digit, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + digit.Int64())
 	}
 
-	return hex.EncodeToString(hashedPassword)
-}
-
-func IsPasswordCorrect(password, hashed string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+	return string(digits), nil
 }
 
-func IsCorrectPhoneNumber(phoneNumber string) bool {
-	return !strings.HasPrefix(phoneNumber, "+62")
+// HashToken returns the hex encoded SHA-256 digest of a high entropy token.
+// Unlike passwords, random tokens do not need a slow salted hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func ValidatePhoneNumber(phoneNumber string) error {
-	if !strings.HasPrefix(phoneNumber, "+62") {
-		return errors.New("phone number should use Indonesia Country Code +62")
-	}
-	return nil
+// HashCode returns the hex encoded HMAC-SHA256 of a low entropy code, e.g. six
+// digits sent by SMS. Unlike a plain digest, which is brute forced in no time,
+// it can not be reversed without the key, so the key must not be stored in
+// the database with the codes.
+func HashCode(key []byte, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
 }